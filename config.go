@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"go-dep-updater/updater"
+	"gopkg.in/yaml.v3"
+)
+
+const defaultConfigFile = ".dep-updater.yaml"
+
+// Config holds default settings read from a config file. Settings given as command line flags override it.
+type Config struct {
+	Root            string                     `yaml:"root"`
+	Dependencies    []updater.DependencyUpdate `yaml:"dependencies"`
+	Exclude         []string                   `yaml:"exclude"`
+	Branch          string                     `yaml:"branch"`
+	CommitMessage   string                     `yaml:"commit-message"`
+	PullRequest     bool                       `yaml:"pr"`
+	Platform        string                     `yaml:"platform"`
+	AllowDowngrade  bool                       `yaml:"allow-downgrade"`
+	AllowPrerelease bool                       `yaml:"allow-prerelease"`
+	Aliases         map[string]string          `yaml:"aliases"`
+}
+
+func loadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %v", path, err)
+	}
+
+	for _, dependency := range cfg.Dependencies {
+		if dependency.Module == "" || dependency.Version == "" {
+			return nil, fmt.Errorf("error in config file %s: every dependency needs both a module and a version", path)
+		}
+	}
+
+	for alias, module := range cfg.Aliases {
+		if strings.ContainsAny(alias, "./") {
+			return nil, fmt.Errorf("error in config file %s: alias %q can't contain a . or /, it would be taken for a module path", path, alias)
+		}
+		if module == "" {
+			return nil, fmt.Errorf("error in config file %s: alias %q has no module", path, alias)
+		}
+	}
+
+	return cfg, nil
+}
+
+// expandAlias returns the module an alias from the config file stands for, or name itself if it isn't one of them,
+// like a module path or a local module such as app
+func expandAlias(name string, aliases map[string]string) string {
+	if module, ok := aliases[name]; ok {
+		return module
+	}
+	return name
+}
+
+// applyConfig copies the settings from cfg that weren't given on the command line into the options.
+// setFlags holds the names of the flags that were given.
+func applyConfig(o *updater.Options, cfg *Config, setFlags map[string]bool) {
+	if !setFlags["root"] && cfg.Root != "" {
+		o.RootDirs = []string{cfg.Root}
+	}
+	if !setFlags["dep"] && len(cfg.Dependencies) > 0 {
+		o.Dependencies = append([]updater.DependencyUpdate(nil), cfg.Dependencies...)
+	}
+	if !setFlags["exclude"] && len(cfg.Exclude) > 0 {
+		o.Excludes = cfg.Exclude
+	}
+	if !setFlags["branch"] && cfg.Branch != "" {
+		o.Branch = cfg.Branch
+	}
+	if !setFlags["commit-message"] && cfg.CommitMessage != "" {
+		o.CommitMessage = cfg.CommitMessage
+	}
+	if !setFlags["pr"] {
+		o.PullRequest = cfg.PullRequest
+	}
+	if !setFlags["platform"] && cfg.Platform != "" {
+		o.Platform = cfg.Platform
+	}
+	if !setFlags["allow-downgrade"] {
+		o.AllowDowngrade = cfg.AllowDowngrade
+	}
+	if !setFlags["allow-prerelease"] {
+		o.AllowPrerelease = cfg.AllowPrerelease
+	}
+}
@@ -1,331 +1,153 @@
 package main
 
 import (
-	"bufio"
-	"fmt"
+	"context"
+	"errors"
+	"flag"
 	"github.com/charmbracelet/log"
-	"github.com/ttacon/chalk"
+	"go-dep-updater/updater"
 	"os"
-	"os/exec"
-	"path"
-	"path/filepath"
+	"os/signal"
 	"strings"
+	"syscall"
 )
 
-const VersionUnknown = "Unknown"
-const VersionNotFound = "NotFound"
+// Exit codes of the process
+const (
+	exitSuccess = 0 // every project was updated, or there was nothing to do
+	exitFailure = 1 // one or more projects failed to update, or --check found outdated projects
+	exitUsage   = 2 // invalid arguments
+	exitAborted = 3 // the user quit at a confirmation prompt
 
-func main() {
-	if len(os.Args) < 4 {
-		log.Errorf("Usage: go-dep-updater <root_directory_path> <dependency> <target-version>")
-		return
-	}
-
-	rootDir := os.Args[1]
-	dependency := os.Args[2]
-	targetVersion := os.Args[3]
-
-	confirmBeforeEach := false
-
-	if len(os.Args) >= 5 {
-		confirmBeforeEach = os.Args[4] == "confirm-each"
-	}
-
-	err := filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		if !info.IsDir() && info.Name() == "go.mod" {
-			projectDir := filepath.Dir(path)
-			projectName := filepath.Base(projectDir)
-
-			currentVersion, upgrade := shouldUpgrade(path, dependency, targetVersion)
-			if !upgrade {
-				log.Debugf("Upgrade not needed for %s\n", projectDir)
-				return nil
-			}
-
-			if confirmBeforeEach {
-				if answer := readInput("Continue with %s?", projectDir); answer != "y" && answer != "yes" {
-					log.Debugf("Skipping %s\n", projectDir)
-					return nil
-				}
-			}
-
-			log.Infof("Updating Project: %s from version %s to %s", projectName, currentVersion, targetVersion)
-
-			printIndentedInfo(projectName, "Checking for uncommitted changes...")
-			if hasUncommittedChanges(projectDir) {
-				printIndentedWarning(projectName, "Warning: Project %s has uncommitted changes. Skipping update.", projectName)
-				return nil
-			}
-
-			printIndentedInfo(projectName, "Checking that current git branch is master...")
-			currentBranch, err := currentGitBranch(projectDir)
-			if err != nil {
-				printIndentedError(projectName, "Error determining current branch for project %s: %v", projectName, err)
-				return nil
-			}
-
-			if currentBranch != "master" {
-				printIndentedInfo(projectName, "Project is not on 'master' branch. Switching...")
-
-				err := gitCheckoutMaster(projectDir)
-				if err != nil {
-					printIndentedError(projectName, "Error switching to 'master' branch for project %s: %v", projectName, err)
-					return nil
-				}
-			}
-
-			printIndentedInfo(projectName, "Pulling latest from origin...")
-			if err := gitPull(projectDir); err != nil {
-				printIndentedError(projectName, "Error pulling changes for project %s: %v", projectName, err)
-				return nil
-			}
-
-			printIndentedInfo(projectName, "Running go get...")
-			if err := goGetUpdate(projectDir, dependency, targetVersion); err != nil {
-				printIndentedError(projectName, "Error updating dependency for project %s: %v", projectName, err)
-				return nil
-			}
-
-			printIndentedInfo(projectName, "Successfully updated dependency %s to %s for %s", dependency, targetVersion, projectName)
-
-			printIndentedInfo(projectName, "Running go vet...")
-			if err := goVet(projectDir); err != nil {
-				printIndentedError(projectName, "Error running go vet for project %s: %v", projectName, err)
-				return fmt.Errorf("aborted due to unwanted project state after update. See above error(s)")
-			}
-
-			printIndentedInfo(projectName, "Running go test...")
-			if err := goTest(projectDir); err != nil {
-				printIndentedError(projectName, "Error running go test for project %s: %v", projectName, err)
-				return fmt.Errorf("aborted due to unwanted project state after update. See above error(s)")
-			}
-
-			if directoryHasFile(projectDir, "main.go") {
-				printIndentedInfo(projectName, "Running go build...")
-
-				if err := goBuild(projectDir); err != nil {
-					printIndentedError(projectName, "Error running go build for project %s: %v", projectName, err)
-					return fmt.Errorf("aborted due to unwanted project state after update")
-				}
-			}
-
-			printIndentedInfo(projectName, "Committing changes to git...")
-			if err := gitCommit(projectDir, dependency, targetVersion); err != nil {
-				printIndentedError(projectName, "Error committing changes for project %s: %v", projectName, err)
-				return nil
-			}
-
-			printIndentedInfo(projectName, "Pushing to git origin...")
-			if err := gitPush(projectDir); err != nil {
-				printIndentedError(projectName, "Error pushing changes for project %s: %v", projectName, err)
-				return nil
-			}
-
-			printIndentedInfo("Done updating %s", projectName)
-		}
-
-		return nil
-	})
+	exitInterrupted = 130 // interrupted with Ctrl-C or SIGTERM, like a shell reports a process killed by SIGINT
+)
 
-	if err != nil {
-		log.Errorf("Error walking the path: %v\n", err)
-		return
-	}
-}
+// Subcommands that split a run in two: plan writes what would be updated to a file, apply updates exactly that
+const (
+	commandPlan  = "plan"
+	commandApply = "apply"
+)
 
-func shouldUpgrade(path, dependency, targetVersion string) (version string, upgrade bool) {
-	currentVersion := getDependencyVersion(path, dependency)
-	isKnownVersion := currentVersion != VersionUnknown && currentVersion != VersionNotFound
-	return currentVersion, isKnownVersion && currentVersion != targetVersion
-}
+// defaultPlanFile is the plan file when plan or apply isn't given one
+const defaultPlanFile = "plan.json"
 
-func hasUncommittedChanges(projectDir string) bool {
-	cmd := exec.Command("git", "status", "--porcelain")
-	cmd.Dir = projectDir
-	out, _ := executeCommand(cmd)
-	return len(out) > 0
+func main() {
+	// run returns instead of exiting, so its deferred calls complete before the process exits
+	os.Exit(run())
 }
 
-func gitPull(projectDir string) error {
-	cmd := exec.Command("git", "pull")
-	cmd.Dir = projectDir
-	out, err := executeCommand(cmd)
-	if err != nil {
-		return fmt.Errorf("%v: %s", err, out)
-	}
-	return nil
-}
+func run() int {
+	ctx, stop := interruptContext()
+	defer stop()
 
-func goGetUpdate(projectDir, dependency, targetVersion string) error {
-	cmd := exec.Command("go", "get", fmt.Sprintf("%s@%s", dependency, targetVersion))
-	cmd.Dir = projectDir
-	out, err := executeCommand(cmd)
-	if err != nil {
-		return fmt.Errorf("%v: %s", err, out)
-	}
+	command, planFile, args := parseCommand(os.Args[1:])
 
-	cmd = exec.Command("go", "mod", "tidy")
-	cmd.Dir = projectDir
-	out, err = executeCommand(cmd)
-	if err != nil {
-		return fmt.Errorf("%v: %s", err, out)
-	}
-	return nil
-}
-
-func goVet(projectDir string) error {
-	cmd := exec.Command("go", "vet", "./...")
-	cmd.Dir = projectDir
-	out, err := executeCommand(cmd)
-	if err != nil {
-		return fmt.Errorf("%v: %s", err, out)
-	}
-	return nil
-}
-
-func goTest(projectDir string) error {
-	cmd := exec.Command("go", "test", "./...")
-	cmd.Dir = projectDir
-	out, err := executeCommand(cmd)
-	if err != nil {
-		return fmt.Errorf("%v: %s", err, out)
+	var plan *updater.Plan
+	if command == commandApply {
+		var err error
+		if plan, err = updater.ReadPlan(planFile); err != nil {
+			log.Errorf("Error reading plan: %v", err)
+			return exitUsage
+		}
 	}
-	return nil
-}
 
-func goBuild(projectDir string) error {
-	cmd := exec.Command("go", "build", "-o", "tmp-app", "main.go")
-	cmd.Dir = projectDir
-	out, err := executeCommand(cmd)
+	opts, err := parseOptions(args, plan)
 	if err != nil {
-		return fmt.Errorf("%v: %s", err, out)
+		log.Errorf("%v", err)
+		flag.Usage()
+		return exitUsage
 	}
+	log.SetDefault(updater.NewLogger(opts))
 
-	cmd = exec.Command("rm", "./tmp-app")
-	cmd.Dir = projectDir
-	out, err = executeCommand(cmd)
-	if err != nil {
-		return fmt.Errorf("%v: %s", err, out)
+	if command == commandPlan {
+		plan, err := updater.MakePlan(ctx, opts)
+		if err != nil {
+			log.Errorf("Error making plan: %v", err)
+			return exitFailure
+		}
+		if err := updater.WritePlan(planFile, plan); err != nil {
+			log.Errorf("Error writing plan to %s: %v", planFile, err)
+			return exitFailure
+		}
+		log.Infof("Wrote the plan to update %d project(s) to %s, run 'go-dep-updater apply %s' to apply it", len(plan.Projects), planFile, planFile)
+		return exitSuccess
 	}
 
-	return nil
-}
-
-func getDependencyVersion(filePath, dependency string) string {
-	data, err := os.ReadFile(filePath)
-	if err != nil {
-		return VersionUnknown
+	var results []*updater.Result
+	if command == commandApply {
+		results, err = updater.Apply(ctx, opts, plan)
+	} else {
+		results, err = updater.Run(ctx, opts)
 	}
 
-	lines := strings.Split(string(data), "\n")
-	for _, line := range lines {
-		if strings.Contains(line, dependency) {
-			parts := strings.Fields(line)
-			if len(parts) > 1 {
-				return parts[1]
-			}
-			return VersionNotFound
+	if ctx.Err() != nil {
+		if len(results) == 0 {
+			log.Warnf("Interrupted, no projects were updated")
+		} else {
+			log.Warnf("Interrupted, the remaining projects were not updated")
 		}
+		return exitInterrupted
 	}
 
-	return VersionUnknown
-}
-
-func gitCommit(projectDir, dependency, targetVersion string) error {
-	cmd := exec.Command("git", "add", "go.mod", "go.sum")
-	cmd.Dir = projectDir
-	out, err := executeCommand(cmd)
-	if err != nil {
-		return fmt.Errorf("%v: %s", err, out)
-	}
-
-	commitMessage := fmt.Sprintf("Updated %s to version %s", dependency, targetVersion)
-	cmd = exec.Command("git", "commit", "-m", commitMessage)
-	cmd.Dir = projectDir
-	out, err = executeCommand(cmd)
-	if err != nil {
-		return fmt.Errorf("%v: %s", err, out)
+	if errors.Is(err, updater.ErrAborted) {
+		if len(results) == 0 {
+			log.Warnf("Aborted, no projects were updated")
+		} else {
+			log.Warnf("Aborted, the remaining projects were not updated")
+		}
+		return exitAborted
 	}
-	return nil
-}
 
-func gitPush(projectDir string) error {
-	cmd := exec.Command("git", "push")
-	cmd.Dir = projectDir
-	out, err := executeCommand(cmd)
 	if err != nil {
-		return fmt.Errorf("%v: %s", err, out)
+		log.Errorf("Stopped updating projects: %v\n", err)
+		return exitFailure
 	}
-	return nil
-}
 
-func currentGitBranch(projectDir string) (string, error) {
-	cmd := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD")
-	cmd.Dir = projectDir
-	out, err := executeCommand(cmd)
-	if err != nil {
-		return "", fmt.Errorf("%v: %s", err, out)
+	if failures := updater.CountFailures(results); failures > 0 {
+		log.Errorf("%d project(s) failed to update", failures)
+		return exitFailure
 	}
-	return strings.TrimSpace(out), err
-}
 
-func gitCheckoutMaster(projectDir string) error {
-	cmd := exec.Command("git", "checkout", "master")
-	cmd.Dir = projectDir
-	out, err := executeCommand(cmd)
-	if err != nil {
-		return fmt.Errorf("%v: %s", err, out)
+	if opts.Check && updater.CountStatus(results, updater.StatusOutdated) > 0 {
+		log.Errorf("%d project(s) are out of date", updater.CountStatus(results, updater.StatusOutdated))
+		return exitFailure
 	}
-	return nil
-}
 
-func executeCommand(cmd *exec.Cmd) (string, error) {
-	output, err := cmd.CombinedOutput()
-	return string(output), err
+	return exitSuccess
 }
 
-func readInput(prompt string, args ...any) string {
-	reader := bufio.NewReader(os.Stdin)
+// interruptContext returns a context that is cancelled at the first SIGINT or SIGTERM. That stops the run once the
+// project being updated is rolled back, and the summary is printed. Another signal exits right away, as usual.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
 
-	// Prompt the user for input
-	fmt.Println(chalk.Yellow.Color(">>> " + fmt.Sprintf(prompt, args...)))
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-interrupts:
+			signal.Stop(interrupts)
+			log.Warnf("Interrupted, stopping after rolling back the current project. Interrupt again to exit right away")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
 
-	// Use the reader to read the input until the first occurrence of \n
-	text, err := reader.ReadString('\n')
-	if err != nil {
-		fmt.Println("An error occurred:", err)
-		return ""
+	return ctx, func() {
+		signal.Stop(interrupts)
+		cancel()
 	}
-
-	// Remove \n from what the user actually wrote
-	return strings.TrimSuffix(text, "\n")
-}
-
-func printIndentedInfo(app, format string, args ...any) {
-	log.Info(fmt.Sprintf("%s: %s", app, fmt.Sprintf(format, args...)))
-}
-
-func printIndentedError(app, format string, args ...any) {
-	log.Error(fmt.Sprintf("%s: %s", app, fmt.Sprintf(format, args...)))
-}
-
-func printIndentedWarning(app, format string, args ...any) {
-	log.Warn(fmt.Sprintf("%s: %s", app, fmt.Sprintf(format, args...)))
 }
 
-func directoryHasFile(directoryPath, fileName string) bool {
-	filePath := path.Join(directoryPath, fileName)
-
-	// Use os.Stat to get the file info
-	_, err := os.Stat(filePath)
+// parseCommand splits off the plan or apply subcommand and the plan file following it, if any, from the arguments
+func parseCommand(args []string) (command, planFile string, rest []string) {
+	if len(args) == 0 || (args[0] != commandPlan && args[0] != commandApply) {
+		return "", "", args
+	}
 
-	// If the error is nil, the file exists
-	if os.IsNotExist(err) {
-		return false
+	command, planFile, rest = args[0], defaultPlanFile, args[1:]
+	if len(rest) > 0 && !strings.HasPrefix(rest[0], "-") {
+		planFile, rest = rest[0], rest[1:]
 	}
-	return true
+	return command, planFile, rest
 }
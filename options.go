@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"go-dep-updater/updater"
+	"golang.org/x/mod/semver"
+	"io"
+	"os"
+	"strings"
+)
+
+// stringsFlag collects every occurrence of a repeatable flag
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// parseOptions parses the command line flags into options. When applying a plan, the plan decides the root
+// directories, dependencies, go version and replacements, so they can't be given as flags.
+func parseOptions(args []string, plan *updater.Plan) (*updater.Options, error) {
+	opts := updater.DefaultOptions()
+
+	var deps stringsFlag
+	var targetVersion string
+	var configFile string
+
+	flag.StringVar(&configFile, "config", "", fmt.Sprintf("Config file with default settings (default: %s in the current directory, if it exists)", defaultConfigFile))
+	flag.Func("root", "Root directory to search for Go projects in. Can be repeated or be a comma-separated list", func(value string) error {
+		for _, dir := range strings.Split(value, ",") {
+			if dir = strings.TrimSpace(dir); dir != "" {
+				opts.RootDirs = append(opts.RootDirs, dir)
+			}
+		}
+		return nil
+	})
+	flag.Var(&deps, "dep", "Dependency to update, as <module>@<version> or just <module> together with --version. The module can be a pattern like github.com/myorg/* or an alias from the config file, and the version can be \"latest\". Use - to read \"<module> <version>\" lines from stdin. Can be repeated")
+	dependencyFile := flag.String("dependency-file", "", "Update the dependencies listed in this file, one \"<module> <version>\" per line. Blank lines and lines starting with # are ignored")
+	fromGoMod := flag.String("from-gomod", "", "Update every dependency required by this go.mod to the version it requires there, e.g. the go.mod of a module with the versions everyone should be on")
+	flag.StringVar(&targetVersion, "version", "", "Version to update a --dep given without @<version> to, e.g. v1.2.3")
+	flag.BoolVar(&opts.Tool, "tool", false, "Update the --dep modules as tools, with go get -tool, in the projects that have tool directives for them (Go 1.24+). Projects that only require them otherwise are left alone")
+	flag.StringVar(&opts.GoVersion, "go-version", "", "Also raise the go directive in go.mod to this version, e.g. 1.22. Can be used without --dep")
+	flag.StringVar(&opts.GoPrivate, "goprivate", "", "Value of GOPRIVATE for the go commands that fetch modules, e.g. github.com/myorg/* (default: inherited from the environment)")
+	flag.Var((*stringsFlag)(&opts.Env), "env", "Environment variable for the go commands (go get, go mod tidy, go vet, go test and go build) as KEY=VALUE, e.g. CGO_ENABLED=0. Overrides the same variable in the environment and --goprivate. Can be repeated")
+	flag.Func("replace", "Replace a module with another module at a version, typically a fork, as <old>=<new>@<version>. Adds a replace directive to every project that requires <old>. Can be repeated", func(value string) error {
+		replacement, err := parseReplacement(value)
+		opts.Replacements = append(opts.Replacements, replacement)
+		return err
+	})
+	flag.Func("exclude-version", "Version of a module to exclude, as <module>@<version>, e.g. a broken release. Adds an exclude directive to every project that requires the module (go mod edit -exclude). Can be repeated", func(value string) error {
+		i := strings.LastIndex(value, "@")
+		if i <= 0 || i == len(value)-1 {
+			return fmt.Errorf("must be <module>@<version>")
+		}
+		opts.ExcludeVersions = append(opts.ExcludeVersions, updater.DependencyUpdate{Module: value[:i], Version: value[i+1:]})
+		return nil
+	})
+	flag.BoolVar(&opts.AllowPrerelease, "allow-prerelease", false, "Include pre-release versions when resolving the latest version")
+	flag.Var((*stringsFlag)(&opts.SkipVersions), "skip-version", "Version to leave out when resolving \"latest\", e.g. a broken release, as <version> or <module>@<version>. Can be repeated")
+	flag.StringVar(&opts.GoBin, "go-bin", opts.GoBin, "The go command to run, as a name on the PATH or a path, e.g. $HOME/.gvm/gos/go1.22/bin/go for a specific Go version")
+	flag.StringVar(&opts.TidyCompat, "tidy-compat", "", "Run go mod tidy with -compat=<version>, keeping go.sum compatible with that Go version, e.g. 1.17 (default: the version before the go directive)")
+	flag.BoolVar(&opts.NoTidy, "no-tidy", false, "Only run go get, without go mod tidy, to keep the change to go.mod and go.sum minimal. go.sum may be left incomplete")
+	flag.BoolVar(&opts.UpdateIndirect, "update-indirect", false, "Also update the dependencies of the updated modules to their latest minor or patch versions, like go get -u")
+	flag.BoolVar(&opts.IncludeTestDeps, "include-test-deps", false, "Also consider the dependencies of tests when updating (go get -t), for dependencies only used in tests")
+	flag.BoolVar(&opts.ImportedOnly, "imported-only", false, "Only update a dependency in projects whose packages (or their tests) import it, checked with go list. Projects that only require it for other dependencies are skipped")
+	flag.BoolVar(&opts.SkipReplaced, "skip-replaced", opts.SkipReplaced, "Skip projects with a replace directive for the dependency. Use --skip-replaced=false to update them anyway")
+	flag.Func("only-if-current", "Only update projects whose current version satisfies this constraint, e.g. \"<v2.0.0\" or \">=v1.2.0,<v1.5.0\"", func(value string) error {
+		constraint, err := updater.ParseVersionConstraint(value)
+		opts.OnlyIfCurrent = constraint
+		return err
+	})
+	flag.BoolVar(&opts.Force, "force", false, "Also run go get and go mod tidy in projects that are already on the target version, e.g. to repair go.sum. Only projects where go.mod or go.sum changed are committed")
+	flag.BoolVar(&opts.AllowDowngrade, "allow-downgrade", false, "Also update projects that are on a newer version than the target version")
+	flag.Var((*stringsFlag)(&opts.Excludes), "exclude", "Glob pattern of directories to skip, matched against the directory name and its path relative to --root. Can be repeated")
+	flag.Var((*stringsFlag)(&opts.Only), "only", "Glob pattern of project names (the directory containing go.mod) to update, skipping all others. Can be repeated")
+	flag.DurationVar(&opts.Since, "since", 0, "Skip projects whose last commit is older than this, e.g. 2160h for 90 days")
+	flag.IntVar(&opts.MaxProjects, "max-projects", 0, "Ask before updating if more than this many projects need updating, or abort when not running in a terminal. 0 means no limit")
+	flag.BoolVar(&opts.Stash, "stash", false, "Stash uncommitted changes before updating a project and restore them afterwards, instead of skipping the project")
+	flag.BoolVar(&opts.CommitWIP, "commit-wip", false, "Commit uncommitted changes to tracked files as a WIP commit of their own before updating a project, instead of skipping the project. Projects with untracked files are still skipped. Requires --pr or --no-push")
+	flag.BoolVar(&opts.ConfirmBeforeEach, "confirm-each", false, "Ask for confirmation before updating each project")
+	flag.BoolVar(&opts.ConfirmPush, "confirm-push", false, "Show the commit and ask for confirmation before pushing it, after go vet, go test and go build have passed. Declined commits are left unpushed")
+	flag.BoolVar(&opts.Verify, "verify", false, "Run go mod verify after updating, failing the project if module checksums don't match")
+	flag.BoolVar(&opts.ShowDiff, "show-diff", false, "Show the changes to go.mod and go.sum before committing them. Always shown with --confirm-each")
+	flag.StringVar(&opts.Branch, "branch", "", "Branch to update in each project (default: auto-detect each project's default branch)")
+	flag.BoolVar(&opts.SkipVet, "skip-vet", false, "Don't run go vet after updating")
+	flag.BoolVar(&opts.SkipTest, "skip-test", false, "Don't run go test after updating")
+	flag.BoolVar(&opts.SkipBuild, "skip-build", false, "Don't run go build after updating")
+	noChecks := flag.Bool("no-checks", false, "Don't run go vet, go test or go build after updating. The update is committed without being validated")
+	flag.StringVar(&opts.VerifyCommand, "verify-cmd", "", "Shell command to validate an update with instead of go vet, go test and go build, run in each project, e.g. \"make test\". A non-zero exit fails the project like a failing go test")
+	flag.Func("test-args", "Extra arguments for go test, e.g. \"-short -count=1\". Packages given as relative paths (./pkg/...) replace the default ./...", func(value string) error {
+		opts.TestArgs = strings.Fields(value)
+		return nil
+	})
+	flag.Func("vet-args", "Extra arguments for go vet. Packages given as relative paths (./pkg/...) replace the default ./...", func(value string) error {
+		opts.VetArgs = strings.Fields(value)
+		return nil
+	})
+	flag.StringVar(&opts.CommitMessage, "commit-message", "", "Commit message template with the placeholders {{.Dependency}}, {{.OldVersion}}, {{.NewVersion}}, {{.Project}} (the directory name) and {{.Module}} (the module path) (default: \"Updated <dependency> to version <version>\")")
+	flag.BoolVar(&opts.Signoff, "signoff", false, "Add a Signed-off-by trailer to commits (git commit --signoff)")
+	flag.Var((*stringsFlag)(&opts.Trailers), "trailer", "Trailer to add to commits as key=value, e.g. Refs=JIRA-123. Can be repeated")
+	flag.BoolVar(&opts.CommitEach, "commit-each", false, "Make a commit for each project in a repository with several projects (go.mod files), instead of one commit for the whole repository. They're still pushed, or opened as a pull request, together")
+	flag.BoolVar(&opts.Amend, "amend", false, "Fold the update into the last commit if it was made by go-dep-updater and isn't pushed yet, instead of creating a new commit. Can't be used with --pr")
+	flag.Var((*stringsFlag)(&opts.PreCommitCommands), "pre-commit-cmd", "Shell command to run in each project after updating and before committing, e.g. \"go generate ./...\". Files it changes are committed too. Can be repeated")
+	flag.StringVar(&opts.Remote, "remote", opts.Remote, "Git remote to pull from and push to")
+	flag.StringVar(&opts.PullStrategy, "pull-strategy", opts.PullStrategy, "How to bring the branch up to date with the remote before updating: merge (git pull), rebase (git pull --rebase) or reset (hard reset to <remote>/<branch>, discarding local commits that aren't pushed)")
+	flag.StringVar(&opts.TagBump, "tag-bump", "", "After committing, tag the commit with the next version of each project, bumping the latest version tag by patch, minor or major, and push the tag along with the commit")
+	flag.BoolVar(&opts.NoPush, "no-push", false, "Commit the update but don't push it (or open a pull request), so the commits can be reviewed locally first")
+	flag.BoolVar(&opts.PullRequest, "pr", false, "Commit to a new dep-update/<dependency>-<version> branch and open a pull request with the GitHub CLI (gh) instead of pushing to the branch directly")
+	mergeRequest := flag.Bool("mr", false, "Like --pr, but open a GitLab merge request with the GitLab CLI (glab). Same as --pr --platform gitlab")
+	flag.StringVar(&opts.BaseRef, "base-ref", "", "Branch, tag or commit to create the --pr branch from instead of the tip of --branch, e.g. a release branch to backport an update to. A branch is also what the pull request targets")
+	flag.StringVar(&opts.Platform, "platform", opts.Platform, "Where --pr opens the pull request: github or gitlab")
+	flag.StringVar(&opts.GitHubToken, "github-token", "", "GitHub token for opening pull requests with the GitHub API instead of the GitHub CLI (gh), e.g. in CI (default: $GITHUB_TOKEN when --github-base-url is given)")
+	flag.StringVar(&opts.GitHubBaseURL, "github-base-url", opts.GitHubBaseURL, "GitHub API URL to open pull requests with instead of the GitHub CLI (gh), e.g. https://github.example.com/api/v3 for GitHub Enterprise Server. The token is taken from $GITHUB_TOKEN unless --github-token is given")
+	flag.StringVar(&opts.GitLabToken, "gitlab-token", "", "GitLab access token for opening merge requests (default: $GITLAB_TOKEN, or the token glab is logged in with)")
+	flag.BoolVar(&opts.RollbackOnFailure, "rollback-on-failure", opts.RollbackOnFailure, "Restore go.mod and go.sum when updating a project fails. Use --rollback-on-failure=false to leave them as they are")
+	flag.BoolVar(&opts.KeepGoing, "keep-going", false, "Continue with the next project when go vet, go test or go build fails after an update, instead of aborting the run")
+	flag.BoolVar(&opts.CollectErrors, "collect-errors", false, "Like --keep-going, and report every failed project with its full error together after the summary, so one run shows everything that's broken")
+	flag.DurationVar(&opts.Timeout, "timeout", opts.Timeout, "Maximum duration of each external command. 0 means no timeout")
+	flag.DurationVar(&opts.NetworkTimeout, "network-timeout", 0, "Maximum duration of git pull/push, go get and go mod tidy (default: --timeout)")
+	flag.DurationVar(&opts.BuildTimeout, "build-timeout", 0, "Maximum duration of go vet and go build (default: --timeout)")
+	flag.DurationVar(&opts.TestTimeout, "test-timeout", 0, "Maximum duration of go test (default: --timeout)")
+	flag.BoolVar(&opts.Verbose, "verbose", false, "Log debug messages too, like which projects don't need updating")
+	flag.BoolVar(&opts.Quiet, "quiet", false, "Only log warnings and errors, besides the final summary")
+	flag.StringVar(&opts.LogLevel, "log-level", "", "Log level: debug, info, warn or error. Overrides --verbose and --quiet")
+	flag.BoolVar(&opts.NoColor, "no-color", false, "Disable colored output. Also disabled when NO_COLOR is set or stdout isn't a terminal")
+	flag.StringVar(&opts.LogFormat, "log-format", opts.LogFormat, "Log format: text, or json for one JSON object per line with the project and step as separate fields")
+	flag.StringVar(&opts.LogFile, "log-file", "", "Also write the logs to this file, along with every command that's run and its output, whatever the log level. Appended to if it exists")
+	flag.IntVar(&opts.Retries, "retries", opts.Retries, "How many times to retry git pull and git push after a transient network failure")
+	flag.DurationVar(&opts.RetryDelay, "retry-delay", opts.RetryDelay, "Delay before the first retry of a git pull or git push, doubled for every following retry")
+	flag.BoolVar(&opts.Cache, "cache", false, "Cache what's read from go.mod files between runs, so unchanged files aren't parsed again, e.g. for repeated --check runs in CI")
+	flag.StringVar(&opts.CacheDir, "cache-dir", "", "Directory to keep the --cache in, turns it on (default: go-dep-updater in the user cache directory)")
+	flag.BoolVar(&opts.NoCache, "no-cache", false, "Don't cache what's read from go.mod files, even with --cache or --cache-dir")
+	flag.StringVar(&opts.NotifyURL, "notify-url", "", "URL to POST a JSON notification to for every project that was pushed, e.g. a Slack incoming webhook. Failing to notify doesn't fail the update")
+	flag.BoolVar(&opts.Timings, "timings", false, "Log how long each step (pull, go-get, vet, test, build, push, ...) took for every repository, and show the time per project and per step in the summary")
+	flag.StringVar(&opts.SummaryJSON, "summary-json", "", "Write the summary of all projects and their outcomes as JSON to this file")
+	flag.StringVar(&opts.Matrix, "matrix", "", "Only list the version of this module (or pattern) every project requires, sorted by version. Doesn't need --dep")
+	flag.BoolVar(&opts.Check, "check", false, "Only report which projects are behind the target version, without any git operations. Exits with status 1 if any are")
+	flag.BoolVar(&opts.DryRun, "dry-run", false, "Report which projects would be updated without changing, committing or pushing anything")
+
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintf(out, "Usage: go-dep-updater --root <dir> --dep <dependency>@<target-version> [--dep ...] [options]\n")
+		fmt.Fprintf(out, "       go-dep-updater --root <dir> --dep <dependency> --version <target-version> [options]\n")
+		fmt.Fprintf(out, "       go-dep-updater <root_directory_path> <dependency> <target-version> [confirm-each]\n")
+		fmt.Fprintf(out, "       go-dep-updater plan [<plan-file>] --root <dir> --dep <dependency>@<target-version> [options]\n")
+		fmt.Fprintf(out, "       go-dep-updater apply [<plan-file>] [options]\n\n")
+		fmt.Fprintf(out, "Options:\n")
+		flag.PrintDefaults()
+	}
+
+	// Parse errors and --help are handled by the flag package itself (ExitOnError)
+	_ = flag.CommandLine.Parse(args)
+
+	if *noChecks {
+		opts.SkipVet, opts.SkipTest, opts.SkipBuild = true, true, true
+	}
+
+	setFlags := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
+
+	// A GITHUB_TOKEN that happens to be set, like in GitHub Actions, doesn't switch --pr away from gh. It's only used
+	// when asked for the API with --github-base-url.
+	if opts.GitHubToken == "" && setFlags["github-base-url"] {
+		opts.GitHubToken = os.Getenv("GITHUB_TOKEN")
+	}
+
+	if *mergeRequest {
+		opts.PullRequest, opts.Platform = true, updater.PlatformGitLab
+		setFlags["pr"], setFlags["platform"] = true, true
+	}
+
+	// Keep supporting the old positional form: <root> <dependency> <version> [confirm-each]
+	positional := flag.Args()
+	if len(positional) >= 3 {
+		setFlags["root"], setFlags["dep"] = true, true
+		opts.RootDirs = []string{positional[0]}
+		deps = stringsFlag{positional[1]}
+		targetVersion = positional[2]
+
+		if len(positional) >= 4 {
+			opts.ConfirmBeforeEach = opts.ConfirmBeforeEach || positional[3] == "confirm-each"
+		}
+	} else if len(positional) > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %v", positional)
+	}
+
+	if plan != nil {
+		for _, name := range []string{"root", "dep", "from-gomod", "dependency-file", "go-version", "replace", "exclude-version", "tool"} {
+			if setFlags[name] {
+				return nil, fmt.Errorf("--%s can't be used when applying a plan, the plan decides what to update", name)
+			}
+		}
+
+		setFlags["root"], setFlags["dep"] = true, true
+		opts.RootDirs, opts.Dependencies = plan.RootDirs, plan.Dependencies
+		opts.GoVersion, opts.Replacements, opts.ExcludeVersions = plan.GoVersion, plan.Replacements, plan.Exclusions
+		opts.Tool = plan.Tool
+	}
+
+	for _, dep := range deps {
+		if dep == "-" {
+			if opts.ConfirmBeforeEach || opts.ConfirmPush {
+				return nil, fmt.Errorf("--confirm-each and --confirm-push can't be used when reading dependencies from stdin")
+			}
+
+			updates, err := readDependencyUpdates(os.Stdin, "stdin")
+			if err != nil {
+				return nil, err
+			}
+			opts.Dependencies = append(opts.Dependencies, updates...)
+			continue
+		}
+
+		update, err := parseDependencyUpdate(dep, targetVersion)
+		if err != nil {
+			return nil, err
+		}
+		opts.Dependencies = append(opts.Dependencies, update)
+	}
+
+	if *fromGoMod != "" {
+		updates, err := updater.ReadGoModDependencies(*fromGoMod)
+		if err != nil {
+			return nil, err
+		}
+		opts.Dependencies = append(opts.Dependencies, updates...)
+		setFlags["dep"] = true
+	}
+
+	if *dependencyFile != "" {
+		file, err := os.Open(*dependencyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading --dependency-file: %v", err)
+		}
+		updates, err := readDependencyUpdates(file, *dependencyFile)
+		_ = file.Close()
+		if err != nil {
+			return nil, err
+		}
+		opts.Dependencies = append(opts.Dependencies, updates...)
+		setFlags["dep"] = true
+	}
+
+	if configFile == "" {
+		if _, err := os.Stat(defaultConfigFile); err == nil {
+			configFile = defaultConfigFile
+		}
+	}
+
+	var aliases map[string]string
+	if configFile != "" {
+		cfg, err := loadConfig(configFile)
+		if err != nil {
+			return nil, err
+		}
+		applyConfig(opts, cfg, setFlags)
+		aliases = cfg.Aliases
+	}
+
+	for i, dependency := range opts.Dependencies {
+		opts.Dependencies[i].Module = expandAlias(dependency.Module, aliases)
+	}
+	opts.Matrix = expandAlias(opts.Matrix, aliases)
+
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	return opts, nil
+}
+
+// parseDependencyUpdate parses <module>@<version>, using defaultVersion when no @<version> is given
+func parseDependencyUpdate(value, defaultVersion string) (updater.DependencyUpdate, error) {
+	module, version := value, defaultVersion
+
+	if i := strings.LastIndex(value, "@"); i >= 0 {
+		module, version = value[:i], value[i+1:]
+	}
+
+	if module == "" {
+		return updater.DependencyUpdate{}, fmt.Errorf("invalid dependency %q: module path is empty", value)
+	}
+	if version == "" {
+		return updater.DependencyUpdate{}, fmt.Errorf("missing version for dependency %s: use --dep %s@<version> or --version", module, module)
+	}
+
+	return updater.DependencyUpdate{Module: module, Version: version}, nil
+}
+
+// parseReplacement parses <old>=<new>@<version>
+func parseReplacement(value string) (updater.Replacement, error) {
+	old, replacement, ok := strings.Cut(value, "=")
+	i := strings.LastIndex(replacement, "@")
+	if !ok || old == "" || i <= 0 || i == len(replacement)-1 {
+		return updater.Replacement{}, fmt.Errorf("invalid --replace %q, must be <old>=<new>@<version>", value)
+	}
+	return updater.Replacement{Old: old, New: replacement[:i], Version: replacement[i+1:]}, nil
+}
+
+// readDependencyUpdates reads dependencies to update from r, one "<module> <version>" per line, where source names
+// r in errors. Blank lines and lines starting with # are ignored. All malformed lines are reported together, along
+// with invalid versions and modules listed more than once.
+func readDependencyUpdates(r io.Reader, source string) ([]updater.DependencyUpdate, error) {
+	var updates []updater.DependencyUpdate
+	var malformed []string
+	firstLines := map[string]int{}
+
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			malformed = append(malformed, fmt.Sprintf("line %d: %q, expected <module> <version>", lineNumber, line))
+			continue
+		}
+
+		module, version := fields[0], fields[1]
+		if version != updater.VersionLatest && !semver.IsValid(version) {
+			malformed = append(malformed, fmt.Sprintf("line %d: invalid version %q for %s, expected a version like v1.2.3 or %s", lineNumber, version, module, updater.VersionLatest))
+			continue
+		}
+		if first, ok := firstLines[module]; ok {
+			malformed = append(malformed, fmt.Sprintf("line %d: %s is already listed on line %d", lineNumber, module, first))
+			continue
+		}
+		firstLines[module] = lineNumber
+
+		updates = append(updates, updater.DependencyUpdate{Module: module, Version: version})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading dependencies from %s: %v", source, err)
+	}
+
+	if len(malformed) > 0 {
+		return nil, fmt.Errorf("malformed dependencies in %s:\n  %s", source, strings.Join(malformed, "\n  "))
+	}
+	if len(updates) == 0 {
+		return nil, fmt.Errorf("no dependencies given in %s", source)
+	}
+	return updates, nil
+}
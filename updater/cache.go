@@ -0,0 +1,179 @@
+package updater
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// cacheMaxAge is how long a cache file is kept after it was last used. Every go.mod that changes leaves the cache
+// file of its old content behind, so they're pruned at the start of each run that uses the cache.
+const cacheMaxAge = 30 * 24 * time.Hour
+
+// goModInfo is what's read from a go.mod to scan its project, as it's cached
+type goModInfo struct {
+	Module   string           `json:"module"`
+	Go       string           `json:"go,omitempty"`
+	Requires []module.Version `json:"requires"`
+	Replaces []goModReplace   `json:"replaces,omitempty"`
+	Excludes []module.Version `json:"excludes,omitempty"`
+	Tools    []string         `json:"tools,omitempty"`
+}
+
+// goModReplace is a replace directive, of Old, or every version of it if it has none, with New
+type goModReplace struct {
+	Old module.Version `json:"old"`
+	New module.Version `json:"new"`
+}
+
+func (r *runner) setGoModCache(opts *Options) {
+	if opts.NoCache || (!opts.Cache && opts.CacheDir == "") {
+		return
+	}
+
+	r.goModCacheDir = opts.CacheDir
+	if r.goModCacheDir == "" {
+		if userCacheDir, err := os.UserCacheDir(); err == nil {
+			r.goModCacheDir = filepath.Join(userCacheDir, "go-dep-updater")
+		}
+	}
+	if r.goModCacheDir != "" {
+		r.pruneCache(r.goModCacheDir, cacheMaxAge)
+	}
+}
+
+// pruneCache removes the cache files that haven't been used for maxAge, and temporary files left by a run that
+// didn't finish writing them
+func (r *runner) pruneCache(cacheDir string, maxAge time.Duration) {
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			r.logger.Debugf("Failed to prune the cache in %s: %v", cacheDir, err)
+		}
+		return
+	}
+
+	pruned := 0
+	for _, entry := range entries {
+		if entry.IsDir() || !(strings.HasSuffix(entry.Name(), ".json") || strings.HasSuffix(entry.Name(), ".tmp")) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < maxAge {
+			continue
+		}
+		if err := os.Remove(filepath.Join(cacheDir, entry.Name())); err == nil {
+			pruned++
+		}
+	}
+	if pruned > 0 {
+		r.logger.Debugf("Pruned %d cache file(s) unused for %d days from %s", pruned, int(maxAge.Hours()/24), cacheDir)
+	}
+}
+
+// readGoMod returns what's declared in the go.mod at filePath, from the cache if the file is unchanged
+func (r *runner) readGoMod(filePath string) (*goModInfo, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheFile := ""
+	if r.goModCacheDir != "" {
+		sum := sha256.Sum256(data)
+		cacheFile = filepath.Join(r.goModCacheDir, hex.EncodeToString(sum[:])+".json")
+
+		if cached, ok := r.goModCacheMemo.Load(cacheFile); ok {
+			return cached.(*goModInfo), nil
+		}
+		if cached, err := os.ReadFile(cacheFile); err == nil {
+			var info goModInfo
+			if err := json.Unmarshal(cached, &info); err == nil && info.Requires != nil {
+				// Mark it as used, so it isn't pruned
+				now := time.Now()
+				_ = os.Chtimes(cacheFile, now, now)
+				r.goModCacheMemo.Store(cacheFile, &info)
+				return &info, nil
+			}
+		}
+	}
+
+	file, err := modfile.Parse(filePath, data, nil)
+	if err != nil {
+		return nil, err
+	}
+	info := newGoModInfo(file)
+
+	if cacheFile != "" {
+		r.goModCacheMemo.Store(cacheFile, info)
+		if err := writeCacheFile(cacheFile, info); err != nil {
+			r.logger.Debugf("Failed to cache what's read from %s: %v", filePath, err)
+		}
+	}
+	return info, nil
+}
+
+func newGoModInfo(file *modfile.File) *goModInfo {
+	info := &goModInfo{Requires: make([]module.Version, 0, len(file.Require))}
+	if file.Module != nil {
+		info.Module = file.Module.Mod.Path
+	}
+	if file.Go != nil {
+		info.Go = file.Go.Version
+	}
+	for _, require := range file.Require {
+		info.Requires = append(info.Requires, require.Mod)
+	}
+	for _, replace := range file.Replace {
+		info.Replaces = append(info.Replaces, goModReplace{Old: replace.Old, New: replace.New})
+	}
+	for _, exclude := range file.Exclude {
+		info.Excludes = append(info.Excludes, exclude.Mod)
+	}
+	for _, tool := range file.Tool {
+		info.Tools = append(info.Tools, tool.Path)
+	}
+	return info
+}
+
+// readRequires returns the modules required by the go.mod at filePath
+func (r *runner) readRequires(filePath string) ([]module.Version, error) {
+	info, err := r.readGoMod(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return info.Requires, nil
+}
+
+// writeCacheFile writes through a temporary file, so a cache file is never read half written
+func writeCacheFile(cacheFile string, info *goModInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cacheFile), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(cacheFile), "*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), cacheFile)
+}
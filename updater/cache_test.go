@@ -0,0 +1,42 @@
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestReadGoModCache(t *testing.T) {
+	dir := t.TempDir()
+	r := defaultRunner()
+	r.goModCacheDir = filepath.Join(dir, "cache")
+
+	goModPath := filepath.Join(dir, "go.mod")
+	content := "module example.com/app\n\ngo 1.22\n\nrequire github.com/foo/bar v1.2.3\n\nexclude github.com/foo/bar v1.2.4\n"
+	if err := os.WriteFile(goModPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := r.readGoMod(goModPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Module != "example.com/app" || info.Go != "1.22" || len(info.Requires) != 1 || len(info.Excludes) != 1 {
+		t.Fatalf("readGoMod() = %+v", info)
+	}
+
+	cacheFiles, _ := filepath.Glob(filepath.Join(r.goModCacheDir, "*.json"))
+	if len(cacheFiles) != 1 {
+		t.Fatalf("got %d cache files, want 1", len(cacheFiles))
+	}
+
+	// An entry that differs from the file shows it's read from the cache instead of parsing the file
+	if err := os.WriteFile(cacheFiles[0], []byte(`{"module":"example.com/cached","requires":[]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r.goModCacheMemo = sync.Map{}
+	if info, err := r.readGoMod(goModPath); err != nil || info.Module != "example.com/cached" {
+		t.Errorf("readGoMod() = %+v, %v, want the cached entry", info, err)
+	}
+}
@@ -0,0 +1,203 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// commandKind groups external commands so each group can have its own timeout
+type commandKind int
+
+const (
+	localCommand commandKind = iota
+	networkCommand
+	buildCommand
+	testCommand
+	// cleanupCommand restores a project after a failed update. It isn't killed when the run is cancelled,
+	// so an interrupted project is still rolled back.
+	cleanupCommand
+)
+
+// errInterrupted is the error of a command killed because the run was cancelled
+var errInterrupted = errors.New("interrupted")
+
+func (r *runner) setCommandTimeouts(opts *Options) {
+	timeoutOrDefault := func(timeout time.Duration) time.Duration {
+		if timeout > 0 {
+			return timeout
+		}
+		return opts.Timeout
+	}
+
+	r.commandTimeouts[localCommand] = opts.Timeout
+	r.commandTimeouts[networkCommand] = timeoutOrDefault(opts.NetworkTimeout)
+	r.commandTimeouts[buildCommand] = timeoutOrDefault(opts.BuildTimeout)
+	r.commandTimeouts[testCommand] = timeoutOrDefault(opts.TestTimeout)
+	r.commandTimeouts[cleanupCommand] = opts.Timeout
+}
+
+// resolveGoBinary checks that the go command can be found and returns it as it's run. A path is made absolute, since
+// the commands run in the projects' directories, a name is kept as is to be found on the PATH.
+func resolveGoBinary(goBin string) (string, error) {
+	if goBin == "" {
+		goBin = "go"
+	}
+	path, err := exec.LookPath(goBin)
+	if err != nil {
+		return "", fmt.Errorf("invalid --go-bin %q: %v", goBin, err)
+	}
+	if strings.ContainsRune(goBin, filepath.Separator) {
+		return filepath.Abs(path)
+	}
+	return goBin, nil
+}
+
+// setGoBinary resolves the go command to run, if the run runs any: to update the projects when updates is set, to
+// resolve latest versions, or to list the imports with --imported-only. Otherwise go doesn't need to be installed.
+func (r *runner) setGoBinary(opts *Options, updates bool) error {
+	runsGo := updates || opts.ImportedOnly
+	for _, dependency := range opts.Dependencies {
+		runsGo = runsGo || dependency.Version == VersionLatest
+	}
+	if !runsGo {
+		return nil
+	}
+
+	goBinary, err := resolveGoBinary(opts.GoBin)
+	if err != nil {
+		return err
+	}
+	r.goBinary = goBinary
+	return nil
+}
+
+func (r *runner) setNetworkRetries(opts *Options) {
+	r.networkRetries = opts.Retries
+	r.networkRetryDelay = opts.RetryDelay
+}
+
+// transientErrorPatterns are found in the output of network commands that may succeed if retried
+var transientErrorPatterns = []string{
+	"Connection reset",
+	"Connection refused",
+	"Failed to connect to",
+	"Connection timed out",
+	"Operation timed out",
+	"Could not resolve host",
+	"Temporary failure in name resolution",
+	"The remote end hung up unexpectedly",
+	"early EOF",
+	"RPC failed",
+	"TLS handshake timeout",
+	"timed out after",
+}
+
+func isTransientError(err error) bool {
+	for _, pattern := range transientErrorPatterns {
+		if strings.Contains(err.Error(), pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryTransient calls fn until it succeeds, fails with an error that doesn't look transient,
+// or networkRetries retries have been made, backing off exponentially between the attempts. Cancelling the run stops
+// the wait for the next attempt.
+func (r *runner) retryTransient(description string, fn func() error) error {
+	delay := r.networkRetryDelay
+
+	err := fn()
+	for retry := 1; retry <= r.networkRetries && err != nil && isTransientError(err); retry++ {
+		r.logger.Debugf("%s failed with what looks like a transient error, retrying in %s (%d/%d): %v", description, delay, retry, r.networkRetries, err)
+		select {
+		case <-r.ctx.Done():
+			return errInterrupted
+		case <-time.After(delay):
+		}
+		delay *= 2
+		err = fn()
+	}
+	return err
+}
+
+// CommandError is returned when an external command fails, with the command line and everything it printed
+type CommandError struct {
+	Cmd    string
+	Output string
+	Err    error
+
+	// goSubcommand is the subcommand of a go command, like test, empty for other commands
+	goSubcommand string
+}
+
+func (e *CommandError) Error() string {
+	output := strings.TrimSpace(e.Output)
+	switch {
+	case output == "":
+		return e.Err.Error()
+	case strings.Contains(output, "\n"):
+		return fmt.Sprintf("%v:\n%s", e.Err, output)
+	default:
+		return fmt.Sprintf("%v: %s", e.Err, output)
+	}
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// executeCommand runs the command in dir and returns its combined output.
+// The command is killed if it runs longer than the timeout configured for its kind.
+// If the command fails, the error is a *CommandError.
+func (r *runner) executeCommand(kind commandKind, dir, name string, args ...string) (string, error) {
+	return r.executeCommandWithEnv(kind, dir, nil, name, args...)
+}
+
+// executeCommandWithEnv is executeCommand with extra KEY=VALUE environment variables added to the current environment
+func (r *runner) executeCommandWithEnv(kind commandKind, dir string, env []string, name string, args ...string) (string, error) {
+	ctx := r.ctx
+	if kind == cleanupCommand {
+		ctx = context.Background()
+	}
+	timeout := r.commandTimeouts[kind]
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	// Don't wait forever for output from child processes that outlive a killed command
+	cmd.WaitDelay = 5 * time.Second
+
+	started := time.Now()
+	stopTracking := r.progress.track(r.logStep)
+	output, err := cmd.CombinedOutput()
+	stopTracking()
+	if timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) && r.ctx.Err() == nil {
+		err = fmt.Errorf("timed out after %s", timeout)
+	} else if err != nil && kind != cleanupCommand && r.ctx.Err() != nil {
+		err = errInterrupted
+	}
+	r.logCommand(dir, env, name, args, string(output), err, time.Since(started))
+	if err != nil {
+		cmdErr := &CommandError{Cmd: strings.Join(append([]string{name}, args...), " "), Output: string(output), Err: err}
+		if name == r.goBinary && len(args) > 0 {
+			cmdErr.goSubcommand = args[0]
+		}
+		return string(output), cmdErr
+	}
+	return string(output), nil
+}
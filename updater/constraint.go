@@ -0,0 +1,93 @@
+package updater
+
+import (
+	"fmt"
+	"golang.org/x/mod/semver"
+	"strings"
+)
+
+// VersionConstraint is a list of comparisons like ">=v1.2.0" that a version must all satisfy
+type VersionConstraint []versionComparison
+
+type versionComparison struct {
+	operator string
+	version  string
+}
+
+// constraintOperators are checked in order, so the two-character operators are matched before their prefixes
+var constraintOperators = []string{"<=", ">=", "!=", "<", ">", "="}
+
+// ParseVersionConstraint parses comma-separated comparisons like "<v2.0.0" or ">=v1.2.0,<v1.5.0".
+// A version without an operator must match exactly.
+func ParseVersionConstraint(value string) (VersionConstraint, error) {
+	var constraint VersionConstraint
+
+	for _, term := range strings.Split(value, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+
+		comparison := versionComparison{operator: "=", version: term}
+		for _, operator := range constraintOperators {
+			if version, ok := strings.CutPrefix(term, operator); ok {
+				comparison = versionComparison{operator: operator, version: strings.TrimSpace(version)}
+				break
+			}
+		}
+
+		if !semver.IsValid(comparison.version) {
+			return nil, fmt.Errorf("invalid version %q in constraint %q", comparison.version, value)
+		}
+		constraint = append(constraint, comparison)
+	}
+
+	if len(constraint) == 0 {
+		return nil, fmt.Errorf("empty version constraint")
+	}
+	return constraint, nil
+}
+
+// allows reports whether version satisfies every comparison. An empty constraint allows any version,
+// otherwise versions that aren't valid semver are never allowed since they can't be compared.
+func (c VersionConstraint) allows(version string) bool {
+	if len(c) == 0 {
+		return true
+	}
+	if !semver.IsValid(version) {
+		return false
+	}
+
+	for _, comparison := range c {
+		cmp := semver.Compare(version, comparison.version)
+
+		var ok bool
+		switch comparison.operator {
+		case "<":
+			ok = cmp < 0
+		case "<=":
+			ok = cmp <= 0
+		case ">":
+			ok = cmp > 0
+		case ">=":
+			ok = cmp >= 0
+		case "!=":
+			ok = cmp != 0
+		default:
+			ok = cmp == 0
+		}
+
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (c VersionConstraint) String() string {
+	terms := make([]string, len(c))
+	for i, comparison := range c {
+		terms[i] = comparison.operator + comparison.version
+	}
+	return strings.Join(terms, ",")
+}
@@ -0,0 +1,120 @@
+package updater
+
+import (
+	"errors"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// Categories of failures, set as the Category of a failed Result. They tell problems with the update itself, like
+// code that no longer compiles against the new version, apart from ones that are likely unrelated to it, like a
+// network error or a test that timed out.
+const (
+	FailureCompile     = "compile"
+	FailureTest        = "test"
+	FailureTestTimeout = "test-timeout"
+	FailureVet         = "vet"
+	FailureDependency  = "dependency"
+	FailureNetwork     = "network"
+	FailureTimeout     = "timeout"
+	FailureKilled      = "killed"
+	FailureGit         = "git"
+	FailureInterrupted = "interrupted"
+	FailureOther       = "other"
+)
+
+// failureCategories is the order the categories are listed in
+var failureCategories = []string{
+	FailureCompile, FailureTest, FailureTestTimeout, FailureVet, FailureDependency, FailureNetwork, FailureTimeout,
+	FailureKilled, FailureGit, FailureInterrupted, FailureOther,
+}
+
+// dependencyErrorPatterns are found in the output of go commands that fail because of go.mod or go.sum rather than
+// the code, e.g. when go get left them inconsistent
+var dependencyErrorPatterns = []string{
+	"missing go.sum entry",
+	"no required module provides package",
+	"updates to go.mod needed",
+	"verifying module",
+	"unknown revision",
+	"no matching versions",
+	"invalid version",
+	"ambiguous import",
+}
+
+// compileErrorRE matches an error of the compiler or type checker, e.g. "./main.go:12:5: undefined: foo".
+// go vet reports type errors prefixed with "vet: ", its own findings aren't prefixed.
+var compileErrorRE = regexp.MustCompile(`(?m)^(vet: )?\S+\.go:\d+(:\d+)?: `)
+
+// testFailureRE matches a failed test, or a test binary that panicked, in the output of go test
+var testFailureRE = regexp.MustCompile(`(?m)^(--- FAIL: |FAIL\t|panic: )`)
+
+// classifyFailure returns the category of the failure of a project with the status, from the command that failed:
+// what it is, its exit code and what it printed
+func classifyFailure(status string, err error) string {
+	if errors.Is(err, errInterrupted) {
+		return FailureInterrupted
+	}
+
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) {
+		if status == StatusFailedNotApplied {
+			return FailureDependency
+		}
+		return FailureOther
+	}
+
+	out := cmdErr.Output
+	goTest := isGoCommand(cmdErr, "test")
+	gitCommand := strings.HasPrefix(cmdErr.Cmd, "git ")
+	// Only the commands that fetch modules or talk to the remote fail because of the network. Tests print what
+	// they like, e.g. a test of an HTTP client failing with "connection refused".
+	fetches := gitCommand || isGoCommand(cmdErr, "get") || isGoCommand(cmdErr, "mod")
+	timedOut := strings.HasPrefix(cmdErr.Err.Error(), "timed out after")
+
+	var exitErr *exec.ExitError
+	// An exit code of -1 means the command was killed by a signal, e.g. by the OOM killer
+	killed := errors.As(cmdErr.Err, &exitErr) && exitErr.ExitCode() == -1
+
+	switch {
+	case timedOut && goTest, strings.Contains(out, "panic: test timed out"):
+		return FailureTestTimeout
+	case timedOut:
+		return FailureTimeout
+	case killed:
+		return FailureKilled
+	case fetches && isTransientError(cmdErr):
+		return FailureNetwork
+	case gitCommand:
+		return FailureGit
+	case isGoCommand(cmdErr, "get") || isGoCommand(cmdErr, "mod") || toolchainErrorRE.MatchString(out):
+		return FailureDependency
+	}
+
+	for _, pattern := range dependencyErrorPatterns {
+		if strings.Contains(out, pattern) {
+			return FailureDependency
+		}
+	}
+
+	switch {
+	case goTest && (strings.Contains(out, "[build failed]") || strings.Contains(out, "[setup failed]")):
+		return FailureCompile
+	case testFailureRE.MatchString(out):
+		return FailureTest
+	case isGoCommand(cmdErr, "vet"):
+		if match := compileErrorRE.FindStringSubmatch(out); match != nil && match[1] != "" {
+			return FailureCompile
+		}
+		return FailureVet
+	case compileErrorRE.MatchString(out):
+		return FailureCompile
+	}
+	return FailureOther
+}
+
+// isGoCommand reports whether the failed command runs the go subcommand, like test in "go test ./..."
+func isGoCommand(cmdErr *CommandError, subcommand string) bool {
+	return cmdErr.goSubcommand == subcommand
+}
@@ -0,0 +1,114 @@
+package updater
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultGitHubBaseURL is the REST API of github.com. The one of a GitHub Enterprise Server is https://<host>/api/v3.
+const DefaultGitHubBaseURL = "https://api.github.com"
+
+// gitHubPullRequest is the request to create a pull request, and the part of the response that's used
+type gitHubPullRequest struct {
+	Title   string `json:"title"`
+	Head    string `json:"head"`
+	Base    string `json:"base"`
+	Body    string `json:"body"`
+	HTMLURL string `json:"html_url,omitempty"`
+}
+
+// gitHubError is the body of an unsuccessful GitHub API response
+type gitHubError struct {
+	Message string `json:"message"`
+	Errors  []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func (e gitHubError) String() string {
+	messages := []string{e.Message}
+	for _, detail := range e.Errors {
+		if detail.Message != "" {
+			messages = append(messages, detail.Message)
+		}
+	}
+	return strings.Join(messages, ": ")
+}
+
+// openPullRequestWithAPI opens a pull request from branch into baseBranch with the GitHub REST API at baseURL,
+// for the repository the remote of the project points to. It needs no GitHub CLI, only a token.
+// It returns the URL of the pull request.
+func (r *runner) openPullRequestWithAPI(projectDir, remote, baseURL, token, baseBranch, branch, title, body string) (string, error) {
+	remoteURL, err := r.executeCommand(localCommand, projectDir, "git", "remote", "get-url", remote)
+	if err != nil {
+		return "", err
+	}
+	owner, name, err := parseRepositoryURL(strings.TrimSpace(remoteURL))
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(gitHubPullRequest{Title: title, Head: branch, Base: baseBranch, Body: body})
+	if err != nil {
+		return "", err
+	}
+
+	ctx := r.ctx
+	if timeout := r.commandTimeouts[networkCommand]; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	endpoint := fmt.Sprintf("%s/repos/%s/%s/pulls", strings.TrimRight(baseURL, "/"), url.PathEscape(owner), url.PathEscape(name))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		var apiErr gitHubError
+		if err := json.NewDecoder(resp.Body).Decode(&apiErr); err != nil || apiErr.Message == "" {
+			return "", fmt.Errorf("creating the pull request in %s/%s failed with %s", owner, name, resp.Status)
+		}
+		return "", fmt.Errorf("creating the pull request in %s/%s failed with %s: %s", owner, name, resp.Status, apiErr)
+	}
+
+	// The pull request is created either way, its URL is only nice to have
+	var created gitHubPullRequest
+	_ = json.NewDecoder(resp.Body).Decode(&created)
+	return created.HTMLURL, nil
+}
+
+// parseRepositoryURL returns the owner and name of the repository at a remote URL, like
+// https://github.com/owner/name.git, ssh://git@github.com/owner/name.git or git@github.com:owner/name.git
+func parseRepositoryURL(remoteURL string) (owner, name string, err error) {
+	repoPath := ""
+	if parsed, parseErr := url.Parse(remoteURL); parseErr == nil && parsed.Scheme != "" && parsed.Host != "" {
+		repoPath = parsed.Path
+	} else if _, scpPath, ok := strings.Cut(remoteURL, ":"); ok && !strings.Contains(remoteURL, "://") {
+		// The scp-like syntax of ssh remotes, [user@]host:owner/name
+		repoPath = scpPath
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimSuffix(strings.Trim(repoPath, "/"), ".git"), "/"), "/")
+	if len(parts) < 2 || parts[len(parts)-2] == "" || parts[len(parts)-1] == "" {
+		return "", "", fmt.Errorf("can't tell the GitHub repository from the remote URL %s", remoteURL)
+	}
+	return parts[len(parts)-2], parts[len(parts)-1], nil
+}
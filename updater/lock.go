@@ -0,0 +1,52 @@
+package updater
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// lockFile returns the path of the lock held while go-dep-updater changes projects, so two runs don't interleave git
+// operations in the same repos. It's per user, in the user cache directory, so one user's lock file doesn't keep
+// another from running. The temporary directory is only used if there's no user cache directory, with the user id
+// in the name for the same reason.
+func lockFile() (string, error) {
+	if userCacheDir, err := os.UserCacheDir(); err == nil {
+		dir := filepath.Join(userCacheDir, "go-dep-updater")
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return "", fmt.Errorf("error creating the directory of the lock file %s: %v", dir, err)
+		}
+		return filepath.Join(dir, "go-dep-updater.lock"), nil
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("go-dep-updater-%d.lock", os.Getuid())), nil
+}
+
+// acquireLock takes the lock at path, failing right away if another run holds it.
+// The returned function releases it.
+func acquireLock(path string) (func(), error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("error opening lock file %s: %v", path, err)
+	}
+
+	if err := lockExclusive(file); err != nil {
+		holder := "another go-dep-updater"
+		if data, readErr := os.ReadFile(path); readErr == nil {
+			if pid, convErr := strconv.Atoi(strings.TrimSpace(string(data))); convErr == nil {
+				holder = fmt.Sprintf("go-dep-updater (pid %d)", pid)
+			}
+		}
+		_ = file.Close()
+		return nil, fmt.Errorf("%s is already running and holds the lock %s: %v", holder, path, err)
+	}
+
+	_ = file.Truncate(0)
+	_, _ = file.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+
+	return func() {
+		_ = unlock(file)
+		_ = file.Close()
+	}, nil
+}
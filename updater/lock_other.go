@@ -0,0 +1,14 @@
+//go:build !unix
+
+package updater
+
+import "os"
+
+// lockExclusive is a no-op where flock isn't available, so concurrent runs aren't prevented there
+func lockExclusive(file *os.File) error {
+	return nil
+}
+
+func unlock(file *os.File) error {
+	return nil
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package updater
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockExclusive takes an flock on the file without waiting. The lock is released by the OS if the process dies.
+func lockExclusive(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+}
+
+func unlock(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,176 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"github.com/charmbracelet/log"
+	"github.com/mattn/go-isatty"
+	"github.com/muesli/termenv"
+	"github.com/ttacon/chalk"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// NewLogger returns a logger like the one every run logs to: to stderr, at the level and in the format and colors of
+// the options. Runs don't change the program's logger, this one lets the program log its own messages the same way.
+func NewLogger(opts *Options) *log.Logger {
+	r := newRunner(context.Background(), log.NewWithOptions(os.Stderr, log.Options{ReportTimestamp: true, Level: opts.Level()}))
+	r.setLogFormat(opts.LogFormat)
+	r.setColor(opts.NoColor)
+	return r.logger
+}
+
+func (r *runner) setLogFormat(format string) {
+	r.structuredLogs = format == LogFormatJSON
+	if r.structuredLogs {
+		r.logger.SetFormatter(log.JSONFormatter)
+	}
+}
+
+func (r *runner) setLogFile(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening --log-file %s: %v", path, err)
+	}
+
+	r.logFile = file
+	r.fileLogger = log.NewWithOptions(file, log.Options{ReportTimestamp: true, Level: log.DebugLevel})
+	if r.structuredLogs {
+		r.fileLogger.SetFormatter(log.JSONFormatter)
+	}
+	r.logger.SetOutput(&logTee{File: os.Stderr, logFile: file})
+
+	r.fileLogger.Info("Started go-dep-updater", "args", strings.Join(os.Args[1:], " "))
+	return nil
+}
+
+func (r *runner) closeLogFile() {
+	if r.logFile == nil {
+		return
+	}
+
+	r.logger.SetOutput(os.Stderr)
+	_ = r.logFile.Close()
+	r.logFile, r.fileLogger = nil, nil
+}
+
+// colorCodeRE matches the escape codes that color the console output
+var colorCodeRE = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// logTee writes the logs to the console and, without colors, to the log file. It embeds the console so the
+// logger sees it as a terminal and keeps coloring the console output.
+type logTee struct {
+	*os.File
+	logFile io.Writer
+}
+
+func (t *logTee) Write(p []byte) (int, error) {
+	_, _ = t.logFile.Write(colorCodeRE.ReplaceAll(p, nil))
+	return t.File.Write(p)
+}
+
+// logCommand records a command that was run in the log file: where, the exact command line including the
+// environment variables it added, how long it took and what it printed
+func (r *runner) logCommand(dir string, env []string, name string, args []string, output string, err error, elapsed time.Duration) {
+	if r.fileLogger == nil {
+		return
+	}
+
+	var words []string
+	for _, word := range append(append(append([]string{}, env...), name), args...) {
+		if word == "" || strings.ContainsAny(word, " \t\n\"'\\$*?") {
+			word = strconv.Quote(word)
+		}
+		words = append(words, word)
+	}
+
+	keyvals := []any{"dir", dir, "cmd", strings.Join(words, " "), "duration", elapsed.Round(time.Millisecond)}
+	if err != nil {
+		keyvals = append(keyvals, "err", err)
+	}
+	if output = strings.TrimSpace(output); output != "" {
+		keyvals = append(keyvals, "output", output)
+	}
+	r.fileLogger.Debug("Ran command", keyvals...)
+}
+
+func (r *runner) setColor(noColor bool) {
+	r.colorEnabled = !noColor && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout)
+	if !r.colorEnabled {
+		r.logger.SetColorProfile(termenv.Ascii)
+	}
+}
+
+func isTerminal(file *os.File) bool {
+	return isatty.IsTerminal(file.Fd()) || isatty.IsCygwinTerminal(file.Fd())
+}
+
+// colorize returns text in the color, unless colors are disabled
+func (r *runner) colorize(color chalk.Color, text string) string {
+	if !r.colorEnabled {
+		return text
+	}
+	return color.Color(text)
+}
+
+func (r *runner) setLogStep(step string) {
+	r.logStep = step
+	if r.repoTimes != nil {
+		r.repoTimes.setStep(step)
+	}
+}
+
+func (r *runner) printIndentedInfo(app, format string, args ...any) {
+	r.logProject(log.InfoLevel, app, format, args...)
+}
+
+func (r *runner) printIndentedError(app, format string, args ...any) {
+	r.logProject(log.ErrorLevel, app, format, args...)
+}
+
+func (r *runner) printIndentedWarning(app, format string, args ...any) {
+	r.logProject(log.WarnLevel, app, format, args...)
+}
+
+func (r *runner) logProject(level log.Level, app, format string, args ...any) {
+	message := strings.TrimRight(fmt.Sprintf(format, args...), "\n")
+
+	if r.structuredLogs {
+		r.logAt(level, message, "project", app, "step", r.logStep)
+		return
+	}
+
+	// Multi-line messages, typically errors with the output of a go or git command, are logged line by line
+	// with the continuation lines indented, so the output keeps its structure and stays readable.
+	lines := strings.Split(message, "\n")
+	r.logAt(level, fmt.Sprintf("%s: %s", app, lines[0]))
+	for _, line := range lines[1:] {
+		if strings.TrimSpace(line) != "" {
+			r.logAt(level, fmt.Sprintf("%s:     %s", app, line))
+		}
+	}
+}
+
+func (r *runner) logAt(level log.Level, message string, keyvals ...any) {
+	switch level {
+	case log.ErrorLevel:
+		r.logger.Error(message, keyvals...)
+	case log.WarnLevel:
+		r.logger.Warn(message, keyvals...)
+	default:
+		r.logger.Info(message, keyvals...)
+	}
+}
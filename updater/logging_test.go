@@ -0,0 +1,65 @@
+package updater
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/charmbracelet/log"
+	"strings"
+	"testing"
+)
+
+// bufferRunner returns a runner that logs to buf, without timestamps
+func bufferRunner(buf *bytes.Buffer) *runner {
+	return newRunner(context.Background(), log.New(buf))
+}
+
+func TestPrintIndented(t *testing.T) {
+	tests := []struct {
+		name  string
+		print func(r *runner, app, format string, args ...any)
+		level string
+	}{
+		{name: "info", print: (*runner).printIndentedInfo, level: "INFO"},
+		{name: "warning", print: (*runner).printIndentedWarning, level: "WARN"},
+		{name: "error", print: (*runner).printIndentedError, level: "ERRO"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.print(bufferRunner(&buf), "service-x", "Error running go vet: %s\n", "exit status 1:\n./main.go:3:2: undefined: foo\n\n  indented line")
+			out := buf.String()
+
+			want := []string{
+				tt.level + " service-x: Error running go vet: exit status 1:",
+				tt.level + " service-x:     ./main.go:3:2: undefined: foo",
+				tt.level + " service-x:       indented line",
+			}
+			if got := strings.Split(strings.TrimRight(out, "\n"), "\n"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+				t.Errorf("got lines\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+			}
+		})
+	}
+}
+
+func TestPrintIndentedStructured(t *testing.T) {
+	var buf bytes.Buffer
+	r := bufferRunner(&buf)
+	r.setLogFormat(LogFormatJSON)
+	r.setLogStep("vet")
+
+	r.printIndentedWarning("service-x", "Warning: first line\nsecond line\n")
+	out := buf.String()
+
+	var entry map[string]string
+	if err := json.Unmarshal([]byte(out), &entry); err != nil {
+		t.Fatalf("expected a single JSON entry, got %q: %v", out, err)
+	}
+	want := map[string]string{"lvl": "warn", "msg": "Warning: first line\nsecond line", "project": "service-x", "step": "vet"}
+	for key, value := range want {
+		if entry[key] != value {
+			t.Errorf("%s = %q, want %q", key, entry[key], value)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package updater
+
+import (
+	"fmt"
+	"golang.org/x/mod/semver"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+)
+
+// matrixEntry is the version of a module a project requires
+type matrixEntry struct {
+	Module  string
+	Version string
+	Project string
+	Dir     string
+}
+
+// versionMatrix returns the version every project requires of the modules matching dependency,
+// sorted by module, then by version from newest to oldest, then by project.
+func (r *runner) versionMatrix(goModPaths []string, dependency string) []matrixEntry {
+	var entries []matrixEntry
+	for _, path := range goModPaths {
+		projectDir := filepath.Dir(path)
+		for _, required := range r.getDependencyVersions(path, dependency) {
+			entries = append(entries, matrixEntry{Module: required.Path, Version: required.Version, Project: filepath.Base(projectDir), Dir: projectDir})
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Module != entries[j].Module {
+			return entries[i].Module < entries[j].Module
+		}
+		if cmp := semver.Compare(entries[i].Version, entries[j].Version); cmp != 0 {
+			return cmp > 0
+		}
+		return entries[i].Project < entries[j].Project
+	})
+	return entries
+}
+
+func printVersionMatrix(dependency string, entries []matrixEntry) {
+	if len(entries) == 0 {
+		fmt.Printf("\nNo projects require %s.\n", dependency)
+		return
+	}
+
+	fmt.Printf("\nVersions of %s in use:\n", dependency)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MODULE\tVERSION\tPROJECTS")
+	for i := 0; i < len(entries); {
+		j := i
+		for j < len(entries) && entries[j].Module == entries[i].Module && entries[j].Version == entries[i].Version {
+			j++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\n", entries[i].Module, entries[i].Version, j-i)
+		i = j
+	}
+	_ = w.Flush()
+
+	fmt.Println()
+
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PROJECT\tMODULE\tVERSION\tDIR")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", entry.Project, entry.Module, entry.Version, entry.Dir)
+	}
+	_ = w.Flush()
+}
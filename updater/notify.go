@@ -0,0 +1,55 @@
+package updater
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// notifyTimeout is the maximum duration of a --notify-url request
+const notifyTimeout = 10 * time.Second
+
+// notification is the payload POSTed to --notify-url for a pushed project. It's the project's entry in the summary,
+// with a text field describing the update, which is what a Slack incoming webhook shows.
+type notification struct {
+	Text string `json:"text"`
+	*Result
+}
+
+// notify POSTs the result of a pushed project to url as JSON
+func (r *runner) notify(url string, res *Result) error {
+	name := res.Project
+	if res.Module != "" {
+		name = res.Module
+	}
+	data, err := json.Marshal(notification{
+		Text:   fmt.Sprintf("%s: %s (%s)", name, describeUpdates(res.Updates), res.Status),
+		Result: res,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(r.ctx, notifyTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected response %s", resp.Status)
+	}
+	return nil
+}
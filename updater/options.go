@@ -0,0 +1,375 @@
+package updater
+
+import (
+	"fmt"
+	"github.com/charmbracelet/log"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/semver"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	PlatformGitHub = "github"
+	PlatformGitLab = "gitlab"
+)
+
+// How the branch is brought up to date with the remote before updating
+const (
+	PullStrategyMerge  = "merge"
+	PullStrategyRebase = "rebase"
+	PullStrategyReset  = "reset"
+)
+
+// Options configures a run. Start from DefaultOptions, the zero value of most fields means the feature is off.
+// See the command line flag of the same name for what each one does.
+type Options struct {
+	RootDirs          []string
+	Dependencies      []DependencyUpdate
+	ConfirmBeforeEach bool
+	Branch            string
+	DryRun            bool
+	PullRequest       bool
+	AllowDowngrade    bool
+	Force             bool
+	SummaryJSON       string
+	AllowPrerelease   bool
+	SkipVersions      []string
+	Excludes          []string
+	Only              []string
+	KeepGoing         bool
+	CollectErrors     bool
+	Timeout           time.Duration
+	NetworkTimeout    time.Duration
+	BuildTimeout      time.Duration
+	TestTimeout       time.Duration
+	CommitMessage     string
+	PreCommitCommands []string
+	Verbose           bool
+	Quiet             bool
+	LogLevel          string
+	Stash             bool
+	RollbackOnFailure bool
+	GoPrivate         string
+	Env               []string
+	Check             bool
+	NoPush            bool
+	Retries           int
+	RetryDelay        time.Duration
+	SkipReplaced      bool
+	UpdateIndirect    bool
+	ShowDiff          bool
+	LogFormat         string
+	LogFile           string
+	Verify            bool
+	TestArgs          []string
+	VetArgs           []string
+	SkipVet           bool
+	SkipTest          bool
+	SkipBuild         bool
+	VerifyCommand     string
+	GoVersion         string
+	Remote            string
+	Platform          string
+	GitLabToken       string
+	GitHubToken       string
+	GitHubBaseURL     string
+	Since             time.Duration
+	Cache             bool
+	CacheDir          string
+	NoCache           bool
+	NoColor           bool
+	MaxProjects       int
+	Amend             bool
+	CommitEach        bool
+	Signoff           bool
+	Trailers          []string
+	OnlyIfCurrent     VersionConstraint
+	Matrix            string
+	IncludeTestDeps   bool
+	ImportedOnly      bool
+	ConfirmPush       bool
+	Replacements      []Replacement
+	ExcludeVersions   []DependencyUpdate
+	PullStrategy      string
+	NotifyURL         string
+	TagBump           string
+	BaseRef           string
+	Timings           bool
+	Tool              bool
+	CommitWIP         bool
+	TidyCompat        string
+	NoTidy            bool
+	GoBin             string
+}
+
+// DefaultOptions returns the options with the same defaults as the command line flags
+func DefaultOptions() *Options {
+	return &Options{
+		Timeout:           10 * time.Minute,
+		Retries:           2,
+		RetryDelay:        2 * time.Second,
+		SkipReplaced:      true,
+		RollbackOnFailure: true,
+		LogFormat:         LogFormatText,
+		Remote:            "origin",
+		Platform:          PlatformGitHub,
+		PullStrategy:      PullStrategyMerge,
+		GitHubBaseURL:     DefaultGitHubBaseURL,
+		GoBin:             "go",
+	}
+}
+
+// DependencyUpdate is a module the user asked to update and the version to update it to
+type DependencyUpdate struct {
+	Module  string `yaml:"module" json:"module"`
+	Version string `yaml:"version" json:"version"`
+}
+
+// Replacement is a module to replace with another module, typically a fork, at a version
+type Replacement struct {
+	Old     string `json:"old"`
+	New     string `json:"new"`
+	Version string `json:"version"`
+}
+
+// clone returns a copy of the options that a run can change, like Apply does with the plan's, without changing the
+// caller's
+func (o *Options) clone() *Options {
+	c := *o
+	c.RootDirs = slices.Clone(o.RootDirs)
+	c.Dependencies = slices.Clone(o.Dependencies)
+	c.SkipVersions = slices.Clone(o.SkipVersions)
+	c.Excludes = slices.Clone(o.Excludes)
+	c.Only = slices.Clone(o.Only)
+	c.PreCommitCommands = slices.Clone(o.PreCommitCommands)
+	c.Env = slices.Clone(o.Env)
+	c.TestArgs = slices.Clone(o.TestArgs)
+	c.VetArgs = slices.Clone(o.VetArgs)
+	c.Trailers = slices.Clone(o.Trailers)
+	c.Replacements = slices.Clone(o.Replacements)
+	c.ExcludeVersions = slices.Clone(o.ExcludeVersions)
+	return &c
+}
+
+// Validate checks that the options are complete and consistent
+func (o *Options) Validate() error {
+	var missing []string
+
+	if len(o.RootDirs) == 0 {
+		missing = append(missing, "--root")
+	}
+	if len(o.Dependencies) == 0 && len(o.Replacements) == 0 && len(o.ExcludeVersions) == 0 && o.GoVersion == "" && o.Matrix == "" {
+		missing = append(missing, "--dep")
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required flag(s): %s", strings.Join(missing, ", "))
+	}
+
+	if o.Verbose && o.Quiet {
+		return fmt.Errorf("--verbose and --quiet can't be used together")
+	}
+
+	if o.VerifyCommand != "" && len(o.skippedChecks()) > 0 {
+		return fmt.Errorf("--verify-cmd replaces go vet, go test and go build, so it can't be used with --skip-vet, --skip-test, --skip-build or --no-checks")
+	}
+
+	if o.Tool && len(o.Dependencies) == 0 {
+		return fmt.Errorf("--tool updates the tools given with --dep, give at least one")
+	}
+
+	if o.CommitWIP && o.Stash {
+		return fmt.Errorf("--commit-wip and --stash can't be used together")
+	}
+
+	if o.CommitWIP && !o.PullRequest && !o.NoPush {
+		return fmt.Errorf("--commit-wip would push the WIP commit to the branch, use it with --pr or --no-push")
+	}
+
+	if o.CommitWIP && o.PullStrategy == PullStrategyReset {
+		return fmt.Errorf("--commit-wip can't be used with --pull-strategy reset, which would discard the WIP commit")
+	}
+
+	if o.Force && o.Check {
+		return fmt.Errorf("--force and --check can't be used together")
+	}
+
+	switch o.LogLevel {
+	case "", "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("invalid --log-level %q, must be one of debug, info, warn or error", o.LogLevel)
+	}
+
+	for _, pattern := range o.Only {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid --only pattern %q: %v", pattern, err)
+		}
+	}
+
+	if o.GoVersion != "" && !modfile.GoVersionRE.MatchString(o.GoVersion) {
+		return fmt.Errorf("invalid --go-version %q, must be a Go version like 1.22 or 1.22.1", o.GoVersion)
+	}
+
+	if o.TidyCompat != "" && !modfile.GoVersionRE.MatchString(o.TidyCompat) {
+		return fmt.Errorf("invalid --tidy-compat %q, must be a Go version like 1.17", o.TidyCompat)
+	}
+
+	if o.NoTidy && o.TidyCompat != "" {
+		return fmt.Errorf("--no-tidy and --tidy-compat can't be used together")
+	}
+
+	if o.Platform != PlatformGitHub && o.Platform != PlatformGitLab {
+		return fmt.Errorf("invalid --platform %q, must be github or gitlab", o.Platform)
+	}
+
+	switch o.PullStrategy {
+	case PullStrategyMerge, PullStrategyRebase, PullStrategyReset:
+	default:
+		return fmt.Errorf("invalid --pull-strategy %q, must be merge, rebase or reset", o.PullStrategy)
+	}
+
+	switch o.TagBump {
+	case "", TagBumpPatch, TagBumpMinor, TagBumpMajor:
+	default:
+		return fmt.Errorf("invalid --tag-bump %q, must be patch, minor or major", o.TagBump)
+	}
+
+	if o.TagBump != "" && o.PullRequest {
+		return fmt.Errorf("--tag-bump can't be used with --pr, the update isn't on the branch to tag until the %s is merged", o.changeRequestName())
+	}
+
+	if o.Amend && o.PullRequest {
+		return fmt.Errorf("--amend can't be used with --pr, every run creates a new branch, which has no earlier update to amend")
+	}
+
+	if o.BaseRef != "" && !o.PullRequest {
+		return fmt.Errorf("--base-ref can only be used with --pr or --mr")
+	}
+
+	if u, err := url.Parse(o.GitHubBaseURL); o.GitHubBaseURL != "" && (err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+		return fmt.Errorf("invalid --github-base-url %q, must be an http or https URL", o.GitHubBaseURL)
+	}
+
+	if o.GitHubBaseURL != "" && o.GitHubBaseURL != DefaultGitHubBaseURL && o.GitHubToken == "" {
+		return fmt.Errorf("--github-base-url is only used with a GitHub token, give one with --github-token or GITHUB_TOKEN")
+	}
+
+	if o.NotifyURL != "" {
+		if u, err := url.Parse(o.NotifyURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid --notify-url %q, must be an http or https URL", o.NotifyURL)
+		}
+	}
+
+	for _, variable := range o.Env {
+		if key, _, ok := strings.Cut(variable, "="); !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return fmt.Errorf("invalid --env %q, must be KEY=VALUE", variable)
+		}
+	}
+
+	for _, trailer := range o.Trailers {
+		if key, _, ok := strings.Cut(trailer, "="); !ok || strings.TrimSpace(key) == "" {
+			return fmt.Errorf("invalid --trailer %q, must be key=value", trailer)
+		}
+	}
+
+	if o.LogFormat != LogFormatText && o.LogFormat != LogFormatJSON {
+		return fmt.Errorf("invalid --log-format %q, must be text or json", o.LogFormat)
+	}
+
+	if _, err := template.New("commit-message").Parse(o.CommitMessage); err != nil {
+		return fmt.Errorf("invalid --commit-message template: %v", err)
+	}
+
+	for _, exclusion := range o.ExcludeVersions {
+		if exclusion.Module == "" || !semver.IsValid(exclusion.Version) {
+			return fmt.Errorf("invalid --exclude-version %s@%s, must be <module>@<version>", exclusion.Module, exclusion.Version)
+		}
+	}
+
+	for _, skip := range o.SkipVersions {
+		version := skip[strings.LastIndex(skip, "@")+1:]
+		if !semver.IsValid(version) {
+			return fmt.Errorf("invalid --skip-version %q, must be a version like v1.2.3 or <module>@<version>", skip)
+		}
+	}
+
+	for _, dependency := range o.Dependencies {
+		if o.skipsVersion(dependency.Module, dependency.Version) {
+			return fmt.Errorf("%s@%s is given with --skip-version, give another version to update to", dependency.Module, dependency.Version)
+		}
+		if isDependencyPattern(dependency.Module) && dependency.Version == VersionLatest {
+			return fmt.Errorf("can't resolve %s for the pattern %s, give a concrete version instead", VersionLatest, dependency.Module)
+		}
+	}
+	return nil
+}
+
+// skipsVersion reports whether the version of the module is given with --skip-version, either on its own or as
+// <module>@<version>
+func (o *Options) skipsVersion(module, version string) bool {
+	for _, skip := range o.SkipVersions {
+		if skip == version || skip == module+"@"+version {
+			return true
+		}
+	}
+	return false
+}
+
+// skippedChecks returns the go commands that validate an update which are skipped: vet, test and/or build
+func (o *Options) skippedChecks() []string {
+	var skipped []string
+	if o.SkipVet {
+		skipped = append(skipped, "vet")
+	}
+	if o.SkipTest {
+		skipped = append(skipped, "test")
+	}
+	if o.SkipBuild {
+		skipped = append(skipped, "build")
+	}
+	return skipped
+}
+
+// changeRequestName is what the platform calls the request to merge a branch that --pr opens
+func (o *Options) changeRequestName() string {
+	if o.Platform == PlatformGitLab {
+		return "merge request"
+	}
+	return "pull request"
+}
+
+// Level returns the log level given by --log-level, --verbose or --quiet
+func (o *Options) Level() log.Level {
+	switch {
+	case o.LogLevel != "":
+		return log.ParseLevel(o.LogLevel)
+	case o.Verbose:
+		return log.DebugLevel
+	case o.Quiet:
+		return log.WarnLevel
+	default:
+		return log.InfoLevel
+	}
+}
+
+// ReadGoModDependencies returns the modules required by the go.mod at path, at the versions it requires
+func ReadGoModDependencies(path string) ([]DependencyUpdate, error) {
+	file, err := parseGoMod(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading --from-gomod %s: %v", path, err)
+	}
+
+	var updates []DependencyUpdate
+	for _, require := range file.Require {
+		updates = append(updates, DependencyUpdate{Module: require.Mod.Path, Version: require.Mod.Version})
+	}
+	if len(updates) == 0 {
+		return nil, fmt.Errorf("--from-gomod %s doesn't require any modules", path)
+	}
+	return updates, nil
+}
@@ -0,0 +1,175 @@
+package updater
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Plan is the list of projects a run would update and exactly how, with VersionLatest already resolved,
+// so applying it later updates to the same versions even if newer ones are released in between
+type Plan struct {
+	Created      time.Time          `json:"created"`
+	RootDirs     []string           `json:"rootDirs"`
+	Dependencies []DependencyUpdate `json:"dependencies,omitempty"`
+	GoVersion    string             `json:"goVersion,omitempty"`
+	Replacements []Replacement      `json:"replacements,omitempty"`
+	Exclusions   []DependencyUpdate `json:"exclusions,omitempty"`
+	Tool         bool               `json:"tool,omitempty"`
+	Projects     []PlannedProject   `json:"projects"`
+}
+
+// PlannedProject is a project in a Plan and the updates to make to it
+type PlannedProject struct {
+	Project string          `json:"project"`
+	GoMod   string          `json:"goMod"`
+	Updates []PendingUpdate `json:"updates"`
+}
+
+// MakePlan finds the projects that need updating like Run does, without changing anything, and returns the plan
+// to update them. The projects are listed in a summary with the planned status.
+func MakePlan(ctx context.Context, opts *Options) (*Plan, error) {
+	opts = opts.clone()
+	r, err := setup(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer r.closeLogFile()
+
+	if err := r.setGoBinary(opts, false); err != nil {
+		return nil, err
+	}
+	if err := r.resolveLatestVersions(opts); err != nil {
+		return nil, err
+	}
+
+	goModPaths, err := r.findProjects(opts)
+	if err != nil {
+		return nil, fmt.Errorf("error walking the path: %v", err)
+	}
+
+	// The paths are made absolute, so the plan can be applied from another working directory
+	rootDirs := make([]string, len(opts.RootDirs))
+	for i, rootDir := range opts.RootDirs {
+		if rootDirs[i], err = filepath.Abs(rootDir); err != nil {
+			return nil, err
+		}
+	}
+
+	plan := &Plan{
+		Created:      time.Now().UTC(),
+		RootDirs:     rootDirs,
+		Dependencies: opts.Dependencies,
+		GoVersion:    opts.GoVersion,
+		Replacements: opts.Replacements,
+		Exclusions:   opts.ExcludeVersions,
+		Tool:         opts.Tool,
+		Projects:     []PlannedProject{},
+	}
+
+	var results []*Result
+	scans := r.scanProjects(opts, goModPaths)
+	for _, goModPath := range goModPaths {
+		p, res := r.checkProject(opts, goModPath, scans[goModPath])
+		if res != nil {
+			results = append(results, res)
+		}
+		if p != nil {
+			absGoModPath, err := filepath.Abs(goModPath)
+			if err != nil {
+				return nil, err
+			}
+			res.Status = StatusPlanned
+			plan.Projects = append(plan.Projects, PlannedProject{Project: p.name, GoMod: absGoModPath, Updates: p.updates})
+		}
+	}
+
+	printSummary(results, false)
+	return plan, nil
+}
+
+// Apply updates the projects in the plan to the planned versions, the same way Run does. Projects whose go.mod
+// changed since the plan was made are skipped, while a go.mod that no longer exists fails it before anything is
+// updated. The plan's root directories, dependencies, go version,
+// replacements, exclusions and --tool replace the ones in opts.
+func Apply(ctx context.Context, opts *Options, plan *Plan) ([]*Result, error) {
+	opts = opts.clone()
+	opts.RootDirs = plan.RootDirs
+	opts.Dependencies = plan.Dependencies
+	opts.GoVersion = plan.GoVersion
+	opts.Replacements = plan.Replacements
+	opts.ExcludeVersions = plan.Exclusions
+	opts.Tool = plan.Tool
+
+	r, err := setup(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer r.closeLogFile()
+
+	if err := r.setGoBinary(opts, !opts.Check && !opts.DryRun); err != nil {
+		return nil, err
+	}
+
+	goModPaths := make([]string, 0, len(plan.Projects))
+	scans := make(map[string]*projectScan, len(plan.Projects))
+	for _, planned := range plan.Projects {
+		if _, err := os.Stat(planned.GoMod); err != nil {
+			return nil, fmt.Errorf("the go.mod of project %s in the plan can't be read, make a new plan: %v", planned.Project, err)
+		}
+
+		scan := r.scanGoMod(opts, planned.GoMod)
+		scan.updates = planned.Updates
+		scan.uses = true
+		for _, update := range planned.Updates {
+			if current := r.currentVersion(planned.GoMod, update); current != update.CurrentVersion {
+				scan.planChange = fmt.Sprintf("%s is at %s instead of %s", update.Module, current, update.CurrentVersion)
+				break
+			}
+		}
+
+		goModPaths = append(goModPaths, planned.GoMod)
+		scans[planned.GoMod] = scan
+	}
+
+	return r.updateProjects(ctx, opts, goModPaths, scans)
+}
+
+// currentVersion returns the version of the update's module, or of the go directive, in the go.mod at goModPath
+func (r *runner) currentVersion(goModPath string, update PendingUpdate) string {
+	if update.Module != goDirective {
+		return r.getDependencyVersion(goModPath, update.Module)
+	}
+
+	file, err := parseGoMod(goModPath)
+	if err != nil || file.Go == nil {
+		return VersionUnknown
+	}
+	return file.Go.Version
+}
+
+// WritePlan writes the plan to path as JSON
+func WritePlan(path string, plan *Plan) error {
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// ReadPlan reads a plan written by WritePlan
+func ReadPlan(path string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{}
+	if err := json.Unmarshal(data, plan); err != nil {
+		return nil, fmt.Errorf("error parsing plan %s: %v", path, err)
+	}
+	return plan, nil
+}
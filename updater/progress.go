@@ -0,0 +1,141 @@
+package updater
+
+import (
+	"fmt"
+	"github.com/charmbracelet/log"
+	"github.com/muesli/termenv"
+	"os"
+	"sync"
+	"time"
+)
+
+// progressInterval is how often the progress is logged when there's no terminal to show it on
+const progressInterval = 30 * time.Second
+
+// spinnerDelay is how long a command runs before the status line shows, so quick commands don't make it flicker
+const spinnerDelay = 500 * time.Millisecond
+
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// progress tracks how far along the run is, counted in repositories that need updating. On a terminal a status line
+// with a spinner shows while a command runs, otherwise the progress is logged every progressInterval.
+type progress struct {
+	total      int
+	position   int
+	current    string
+	start      time.Time
+	lastReport time.Time
+	live       bool
+	logger     *log.Logger
+}
+
+func newProgress(total int, live bool, logger *log.Logger) *progress {
+	now := time.Now()
+	return &progress{total: total, start: now, lastReport: now, live: live, logger: logger}
+}
+
+// showLiveProgress reports whether the status line can be drawn: stderr is a terminal the logs are written to as text
+func (r *runner) showLiveProgress(opts *Options) bool {
+	return isTerminal(os.Stderr) && !r.structuredLogs && opts.Level() <= log.InfoLevel
+}
+
+// next moves on to the repository
+func (p *progress) next(repoName string) {
+	if p == nil {
+		return
+	}
+	p.position++
+	p.current = repoName
+}
+
+// label returns the position of the current repository in the run, like "[12/80] ", to prefix its messages with
+func (p *progress) label() string {
+	if p == nil || p.current == "" {
+		return ""
+	}
+	return fmt.Sprintf("[%d/%d] ", p.position, p.total)
+}
+
+// finished logs the progress once the current repository is done, if it's been long enough since it last was
+func (p *progress) finished() {
+	if p == nil {
+		return
+	}
+	p.current = ""
+	if p.live || p.position == 0 || p.position >= p.total || time.Since(p.lastReport) < progressInterval {
+		return
+	}
+	p.lastReport = time.Now()
+
+	elapsed := time.Since(p.start)
+	remaining := elapsed / time.Duration(p.position) * time.Duration(p.total-p.position)
+	p.logger.Infof("Progress: %d of %d repositories done in %s, about %s left", p.position, p.total, formatDuration(elapsed), formatDuration(remaining.Round(time.Second)))
+}
+
+// track shows the status line while a command runs in the step, until the returned function is called
+func (p *progress) track(step string) func() {
+	if p == nil || !p.live || p.current == "" {
+		return func() {}
+	}
+
+	output := termenv.NewOutput(os.Stderr)
+	status := p.label() + p.current
+	if step != "" {
+		status += ": " + step
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		started := time.Now()
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+
+		drawn := false
+		for frame := 0; ; frame++ {
+			select {
+			case <-done:
+				if drawn {
+					fmt.Fprint(os.Stderr, "\r")
+					output.ClearLine()
+				}
+				return
+			case <-ticker.C:
+				if elapsed := time.Since(started); elapsed >= spinnerDelay {
+					fmt.Fprint(os.Stderr, "\r")
+					output.ClearLine()
+					fmt.Fprintf(os.Stderr, "%s %s %s", spinnerFrames[frame%len(spinnerFrames)], status, elapsed.Round(time.Second))
+					drawn = true
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// countRepositoriesToUpdate counts the repositories with a project that's behind on anything
+func countRepositoriesToUpdate(repos []*repository, scans map[string]*projectScan) int {
+	count := 0
+	for _, repo := range repos {
+		if repositoryNeedsUpdate(repo, scans) {
+			count++
+		}
+	}
+	return count
+}
+
+// repositoryNeedsUpdate reports whether any project of the repository is behind on anything
+func repositoryNeedsUpdate(repo *repository, scans map[string]*projectScan) bool {
+	for _, path := range repo.GoModPaths {
+		if len(scans[path].updates) > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package updater
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// repository is a git repository with one or more projects (go.mod files) in it. The projects of a repository
+// are updated together and committed and pushed as one change.
+type repository struct {
+	Name       string
+	Dir        string
+	GoModPaths []string
+}
+
+// groupByRepository groups the go.mod paths by the git repository they're in, keeping the order they were found in.
+// A repository with a single project is named after and operated on in the project's directory, like before, while
+// a repository with several projects is operated on from its top-level directory.
+// Projects outside a git repository get a group of their own.
+func (r *runner) groupByRepository(goModPaths []string) []*repository {
+	var repos []*repository
+	byTopLevel := map[string]*repository{}
+
+	for _, goModPath := range goModPaths {
+		projectDir := filepath.Dir(goModPath)
+
+		topLevel, err := r.gitTopLevel(projectDir)
+		if err != nil {
+			topLevel = projectDir
+		}
+
+		repo, ok := byTopLevel[topLevel]
+		if !ok {
+			repo = &repository{Name: filepath.Base(topLevel), Dir: topLevel}
+			byTopLevel[topLevel] = repo
+			repos = append(repos, repo)
+		}
+		repo.GoModPaths = append(repo.GoModPaths, goModPath)
+	}
+
+	for _, repo := range repos {
+		if len(repo.GoModPaths) == 1 {
+			repo.Dir = filepath.Dir(repo.GoModPaths[0])
+			repo.Name = filepath.Base(repo.Dir)
+		}
+	}
+	return repos
+}
+
+// singleProjectRepositories puts every go.mod path in a group of its own, without finding out which git repository
+// it's in
+func singleProjectRepositories(goModPaths []string) []*repository {
+	repos := make([]*repository, 0, len(goModPaths))
+	for _, goModPath := range goModPaths {
+		projectDir := filepath.Dir(goModPath)
+		repos = append(repos, &repository{Name: filepath.Base(projectDir), Dir: projectDir, GoModPaths: []string{goModPath}})
+	}
+	return repos
+}
+
+// gitTopLevel returns the top-level directory of the git repository dir is in
+func (r *runner) gitTopLevel(dir string) (string, error) {
+	out, err := r.executeCommand(localCommand, dir, "git", "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Clean(strings.TrimSpace(out)), nil
+}
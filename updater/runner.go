@@ -0,0 +1,66 @@
+package updater
+
+import (
+	"context"
+	"github.com/charmbracelet/log"
+	"os"
+	"sync"
+	"time"
+)
+
+// runner holds the state of a run of Run, MakePlan or Apply: what it logs to, how it runs commands and how far along
+// it is. Every run has its own, so runs in the same program don't share any of it, nor change the program's logger.
+type runner struct {
+	// ctx is the context of the run, cancelling it kills running commands
+	ctx    context.Context
+	logger *log.Logger
+
+	// structuredLogs is set with --log-format json. The project and step are then logged as attributes
+	// instead of being prefixed to the message.
+	structuredLogs bool
+	// colorEnabled is unset with --no-color, when NO_COLOR is set, or when stdout isn't a terminal
+	colorEnabled bool
+	// logStep is the step of the update pipeline the current project is in
+	logStep string
+	// logFile is set with --log-file. It gets a copy of the logs, and every command that's run along with its output.
+	logFile *os.File
+	// fileLogger logs the commands to logFile, whatever the log level
+	fileLogger *log.Logger
+
+	// commandTimeouts is the maximum duration of a command of each kind. Zero means no timeout.
+	commandTimeouts map[commandKind]time.Duration
+	// goBinary is the go command that's run, "go" on the PATH unless another one is given with --go-bin
+	goBinary string
+	// networkRetries is how many times network git commands are retried after a transient failure.
+	// networkRetryDelay is the delay before the first retry, which doubles for every following retry.
+	networkRetries    int
+	networkRetryDelay time.Duration
+
+	// progress tracks the repositories being updated
+	progress *progress
+	// repoTimes measures the repository being updated
+	repoTimes *stepTimes
+	// goModCacheDir holds what was read from go.mod files in earlier runs, one file per go.mod keyed by the hash of
+	// its content, so go.mod files that haven't changed aren't parsed again. Empty disables the cache, which is opt-in.
+	goModCacheDir string
+	// goModCacheMemo holds the cache entries read or written in this run by their cache file, so a go.mod that's
+	// read several times while scanning its project doesn't go to the disk each time
+	goModCacheMemo sync.Map
+}
+
+// newRunner returns a runner with the defaults of the options, which logs to logger
+func newRunner(ctx context.Context, logger *log.Logger) *runner {
+	return &runner{
+		ctx:             ctx,
+		logger:          logger,
+		colorEnabled:    true,
+		commandTimeouts: map[commandKind]time.Duration{},
+		goBinary:        "go",
+	}
+}
+
+// defaultRunner runs the exported helpers that are used on their own, outside of a run. They log to the program's
+// default logger.
+func defaultRunner() *runner {
+	return newRunner(context.Background(), log.Default())
+}
@@ -0,0 +1,68 @@
+package updater
+
+import (
+	"path/filepath"
+	"sync"
+)
+
+// projectScan is what reading a project's go.mod found: the updates it needs and which dependencies it uses
+type projectScan struct {
+	updates          []PendingUpdate
+	usedDependencies []string
+	uses             bool
+	// module is the module path declared in go.mod, empty if it couldn't be read
+	module string
+	// planChange describes how the go.mod changed since the plan the updates come from was made, if it did
+	planChange string
+}
+
+// scanWorkers is how many go.mod files are read at the same time. Reading them is I/O-bound, so it doesn't depend
+// on the number of CPUs.
+const scanWorkers = 16
+
+// scanProjects reads the go.mod of every project concurrently, since it's I/O-bound and doesn't change anything,
+// and returns the scans by go.mod path. Everything that changes projects runs serially afterwards.
+func (r *runner) scanProjects(opts *Options, goModPaths []string) map[string]*projectScan {
+	scans := make([]*projectScan, len(goModPaths))
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < scanWorkers && i < len(goModPaths); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				scans[index] = r.scanGoMod(opts, goModPaths[index])
+			}
+		}()
+	}
+
+	for index := range goModPaths {
+		indexes <- index
+	}
+	close(indexes)
+	wg.Wait()
+
+	byPath := make(map[string]*projectScan, len(goModPaths))
+	for index, goModPath := range goModPaths {
+		byPath[goModPath] = scans[index]
+	}
+	return byPath
+}
+
+func (r *runner) scanGoMod(opts *Options, goModPath string) *projectScan {
+	scan := &projectScan{updates: r.projectUpdates(opts, goModPath)}
+	if modulePath, err := r.moduleName(goModPath); err == nil {
+		scan.module = modulePath
+	} else {
+		r.logger.Debugf("Could not read the module path of %s: %v", filepath.Dir(goModPath), err)
+	}
+
+	for _, dependency := range opts.Dependencies {
+		if len(r.getDependencyVersions(goModPath, dependency.Module)) > 0 {
+			scan.usedDependencies = append(scan.usedDependencies, dependency.Module)
+		}
+	}
+	scan.uses = len(scan.usedDependencies) > 0 || r.usesAnyReplacement(goModPath, opts.Replacements) || r.usesAnyExclusion(goModPath, opts.ExcludeVersions)
+	return scan
+}
@@ -0,0 +1,208 @@
+package updater
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	StatusUpdated               = "updated"
+	StatusCommitted             = "committed-not-pushed"
+	StatusUnchanged             = "unchanged"
+	StatusDryRun                = "dry-run"
+	StatusOutdated              = "outdated"
+	StatusPlanned               = "planned"
+	StatusSkippedNotNeeded      = "skipped-not-needed"
+	StatusSkippedDeclined       = "skipped-declined"
+	StatusSkippedUncommitted    = "skipped-uncommitted"
+	StatusSkippedNoBranch       = "skipped-no-branch"
+	StatusSkippedNotGitRepo     = "skipped-not-git-repo"
+	StatusSkippedUnsupportedVCS = "skipped-unsupported-vcs"
+	StatusSkippedInProgress     = "skipped-in-progress"
+	StatusSkippedPlanChanged    = "skipped-plan-changed"
+	StatusSkippedReplaced       = "skipped-replaced"
+	StatusSkippedNotImported    = "skipped-not-imported"
+	StatusSkippedStale          = "skipped-stale"
+	StatusSkippedBranchExists   = "skipped-branch-exists"
+	StatusFailed                = "failed"
+	StatusFailedVet             = "failed-vet"
+	StatusFailedTests           = "failed-tests"
+	StatusFailedBuild           = "failed-build"
+	StatusFailedVerify          = "failed-verify"
+	StatusFailedNotApplied      = "failed-not-applied"
+)
+
+// Result is the outcome of running the update pipeline for a single project
+type Result struct {
+	Project string `json:"project"`
+	// Module is the module path declared in the project's go.mod, empty if it couldn't be read
+	Module  string          `json:"module,omitempty"`
+	Dir     string          `json:"dir"`
+	Updates []PendingUpdate `json:"updates,omitempty"`
+	Status  string          `json:"status"`
+	Error   string          `json:"error,omitempty"`
+	// Category is what kind of failure a failed project had, one of the Failure constants
+	Category string   `json:"category,omitempty"`
+	Notes    []string `json:"notes,omitempty"`
+	// OtherChanges are the requirements that changed along with the updates, typically indirect ones by go mod tidy
+	OtherChanges []RequirementChange `json:"otherChanges,omitempty"`
+	// Verified is whether go.mod was confirmed to have the updates after updating, unset if it wasn't checked
+	Verified *bool `json:"verified,omitempty"`
+	// Seconds is how long updating the project's repository took. Timings is how long each step of it took in
+	// seconds, with --timings.
+	Seconds float64            `json:"seconds,omitempty"`
+	Timings map[string]float64 `json:"timings,omitempty"`
+}
+
+// RequirementChange is a requirement in go.mod that changed along with an update without being asked for.
+// The old version is empty for requirements that were added, and the new one for requirements that were removed.
+type RequirementChange struct {
+	Module     string `json:"module"`
+	OldVersion string `json:"oldVersion,omitempty"`
+	NewVersion string `json:"newVersion,omitempty"`
+}
+
+func (c RequirementChange) String() string {
+	switch {
+	case c.OldVersion == "":
+		return fmt.Sprintf("added %s %s", c.Module, c.NewVersion)
+	case c.NewVersion == "":
+		return fmt.Sprintf("removed %s %s", c.Module, c.OldVersion)
+	default:
+		return fmt.Sprintf("%s %s => %s", c.Module, c.OldVersion, c.NewVersion)
+	}
+}
+
+func (r *Result) skipped(status string) *Result {
+	r.Status = status
+	return r
+}
+
+func (r *Result) failed(status string, err error) *Result {
+	r.Status = status
+	r.Error = err.Error()
+	r.Category = classifyFailure(status, err)
+	return r
+}
+
+func CountStatus(results []*Result, status string) int {
+	count := 0
+	for _, res := range results {
+		if res.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// CountFailures counts the projects with any of the failed statuses
+func CountFailures(results []*Result) int {
+	count := 0
+	for _, res := range results {
+		if strings.HasPrefix(res.Status, StatusFailed) {
+			count++
+		}
+	}
+	return count
+}
+
+// printSummary prints a table of the results, with how long each project took if withTimes is set
+func printSummary(results []*Result, withTimes bool) {
+	if len(results) == 0 {
+		fmt.Println("\nNo projects use the given dependencies.")
+		return
+	}
+
+	fmt.Println("\nSummary:")
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if withTimes {
+		fmt.Fprintln(w, "PROJECT\tDEPENDENCY\tFROM\tTO\tRESULT\tTIME\tNOTES")
+	} else {
+		fmt.Fprintln(w, "PROJECT\tDEPENDENCY\tFROM\tTO\tRESULT\tNOTES")
+	}
+
+	for _, res := range results {
+		status := res.Status
+		if withTimes {
+			elapsed := "-"
+			if res.Seconds > 0 {
+				elapsed = formatDuration(time.Duration(res.Seconds * float64(time.Second)))
+			}
+			status += "\t" + elapsed
+		}
+		notes := strings.Join(res.Notes, "; ")
+		if len(res.Updates) == 0 {
+			fmt.Fprintf(w, "%s\t-\t-\t-\t%s\t%s\n", res.Project, status, notes)
+			continue
+		}
+		for _, update := range res.Updates {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", res.Project, update.Module, update.CurrentVersion, update.target(), status, notes)
+		}
+	}
+
+	_ = w.Flush()
+
+	printFailureCategories(results)
+
+	if stale := CountStatus(results, StatusSkippedStale); stale > 0 {
+		fmt.Printf("\n%d project(s) skipped as stale, with no recent commits (--since)\n", stale)
+	}
+}
+
+// printFailureCategories lists the failed projects grouped by the category of their failure, to tell the ones that
+// need fixing apart from the ones that are likely worth retrying
+func printFailureCategories(results []*Result) {
+	byCategory := map[string][]string{}
+	for _, res := range results {
+		if strings.HasPrefix(res.Status, StatusFailed) {
+			byCategory[res.Category] = append(byCategory[res.Category], res.Project)
+		}
+	}
+	if len(byCategory) == 0 {
+		return
+	}
+
+	fmt.Println("\nFailures by category:")
+	for _, category := range failureCategories {
+		if projects := byCategory[category]; len(projects) > 0 {
+			fmt.Printf("  %s (%d): %s\n", category, len(projects), strings.Join(projects, ", "))
+		}
+	}
+}
+
+// printFailureReport prints every failed project with its status and full error, the output of the failed
+// command included, so all failures of a run can be looked into at once
+func printFailureReport(results []*Result) {
+	failures := CountFailures(results)
+	if failures == 0 {
+		return
+	}
+
+	fmt.Printf("\nFailures (%d):\n", failures)
+	for _, res := range results {
+		if !strings.HasPrefix(res.Status, StatusFailed) {
+			continue
+		}
+
+		fmt.Printf("\n%s (%s): %s, %s\n", res.Project, res.Dir, res.Status, res.Category)
+		for _, line := range strings.Split(strings.TrimSpace(res.Error), "\n") {
+			fmt.Printf("    %s\n", line)
+		}
+		if len(res.Notes) > 0 {
+			fmt.Printf("    Notes: %s\n", strings.Join(res.Notes, "; "))
+		}
+	}
+}
+
+func writeSummaryJSON(path string, results []*Result) error {
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,111 @@
+package updater
+
+import (
+	"fmt"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	"strings"
+)
+
+// What part of the version --tag-bump increments
+const (
+	TagBumpPatch = "patch"
+	TagBumpMinor = "minor"
+	TagBumpMajor = "major"
+)
+
+// tagRelease tags the commit with the update with the next version of the project, and pushes the tag if the commit
+// was pushed. Projects in a subdirectory of the repository are tagged with the directory as prefix, like
+// tools/v1.2.3, which is how the go command finds versions of nested modules.
+// It returns the tag that was created.
+func (r *runner) tagRelease(opts *Options, p *project, push bool) (string, error) {
+	prefix, err := r.gitPrefix(p.dir)
+	if err != nil {
+		return "", err
+	}
+
+	tags, err := r.gitTags(p.dir, prefix+"v*")
+	if err != nil {
+		return "", err
+	}
+
+	file, err := parseGoMod(p.goModPath)
+	if err != nil {
+		return "", err
+	}
+	modulePath := ""
+	if file.Module != nil {
+		modulePath = file.Module.Mod.Path
+	}
+
+	tag, err := nextVersionTag(prefix, tags, opts.TagBump, modulePath)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := r.executeCommand(localCommand, p.dir, "git", "tag", "-a", tag, "-m", tag); err != nil {
+		return "", err
+	}
+	if !push {
+		return tag, nil
+	}
+
+	return tag, r.retryTransient("git push", func() error {
+		_, err := r.executeCommand(networkCommand, p.dir, "git", "push", opts.Remote, "refs/tags/"+tag)
+		return err
+	})
+}
+
+// nextVersionTag returns the tag following the highest release version among the tags, incremented as given by bump.
+// Without any release tags the version is bumped from v0.0.0. A new major version from v2 on must be in the module
+// path, or the go command won't accept it.
+func nextVersionTag(prefix string, tags []string, bump, modulePath string) (string, error) {
+	latest := "v0.0.0"
+	for _, tag := range tags {
+		version := strings.TrimPrefix(tag, prefix)
+		if semver.IsValid(version) && semver.Prerelease(version) == "" && semver.Build(version) == "" && semver.Compare(version, latest) > 0 {
+			latest = version
+		}
+	}
+
+	var major, minor, patch int
+	if _, err := fmt.Sscanf(semver.Canonical(latest), "v%d.%d.%d", &major, &minor, &patch); err != nil {
+		return "", fmt.Errorf("can't parse the latest version %s: %v", latest, err)
+	}
+
+	switch bump {
+	case TagBumpPatch:
+		patch++
+	case TagBumpMinor:
+		minor, patch = minor+1, 0
+	case TagBumpMajor:
+		major, minor, patch = major+1, 0, 0
+	}
+	next := fmt.Sprintf("v%d.%d.%d", major, minor, patch)
+
+	if major >= 2 && modulePath != "" && !strings.HasPrefix(modulePath, "gopkg.in/") {
+		if _, pathMajor, _ := module.SplitPathVersion(modulePath); pathMajor != fmt.Sprintf("/v%d", major) {
+			return "", fmt.Errorf("can't tag %s, the module path %s must end with /v%d first", next, modulePath, major)
+		}
+	}
+	return prefix + next, nil
+}
+
+// gitPrefix returns the path of dir relative to the top-level directory of its git repository, with a trailing
+// slash, or an empty string at the top level
+func (r *runner) gitPrefix(dir string) (string, error) {
+	out, err := r.executeCommand(localCommand, dir, "git", "rev-parse", "--show-prefix")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// gitTags returns the tags matching the pattern
+func (r *runner) gitTags(dir, pattern string) ([]string, error) {
+	out, err := r.executeCommand(localCommand, dir, "git", "tag", "--list", pattern)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(out), nil
+}
@@ -0,0 +1,132 @@
+package updater
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// stepTimes measures how long updating a repository takes, and how long each step of it takes, from when the step
+// is set with setLogStep until the next one is
+type stepTimes struct {
+	start     time.Time
+	step      string
+	stepStart time.Time
+	durations map[string]time.Duration
+	order     []string
+}
+
+func newStepTimes() *stepTimes {
+	now := time.Now()
+	return &stepTimes{start: now, stepStart: now, durations: map[string]time.Duration{}}
+}
+
+func (t *stepTimes) setStep(step string) {
+	now := time.Now()
+	if t.step != "" {
+		if _, ok := t.durations[t.step]; !ok {
+			t.order = append(t.order, t.step)
+		}
+		t.durations[t.step] += now.Sub(t.stepStart)
+	}
+	t.step, t.stepStart = step, now
+}
+
+// stop ends the current step and returns how long the repository took
+func (t *stepTimes) stop() time.Duration {
+	t.setStep("")
+	return time.Since(t.start)
+}
+
+// elapsed returns how long the repository has taken so far
+func (t *stepTimes) elapsed() time.Duration {
+	if t == nil {
+		return 0
+	}
+	return time.Since(t.start)
+}
+
+// seconds returns the duration of each step in seconds
+func (t *stepTimes) seconds() map[string]float64 {
+	seconds := map[string]float64{}
+	for step, duration := range t.durations {
+		seconds[step] = roundSeconds(duration)
+	}
+	return seconds
+}
+
+// String lists the steps in the order they were taken, e.g. "pull 1.2s, go-get 3.4s, test 12s"
+func (t *stepTimes) String() string {
+	steps := make([]string, 0, len(t.order))
+	for _, step := range t.order {
+		steps = append(steps, fmt.Sprintf("%s %s", step, formatDuration(t.durations[step])))
+	}
+	return strings.Join(steps, ", ")
+}
+
+// add adds the durations of the steps of other to t
+func (t *stepTimes) add(other *stepTimes) {
+	for _, step := range other.order {
+		if _, ok := t.durations[step]; !ok {
+			t.order = append(t.order, step)
+		}
+		t.durations[step] += other.durations[step]
+	}
+}
+
+// slowestFirst lists the steps like String, but from the slowest to the fastest
+func (t *stepTimes) slowestFirst() string {
+	sorted := &stepTimes{durations: t.durations, order: append([]string(nil), t.order...)}
+	sort.SliceStable(sorted.order, func(i, j int) bool {
+		return t.durations[sorted.order[i]] > t.durations[sorted.order[j]]
+	})
+	return sorted.String()
+}
+
+// recordTimes stops measuring the repository, records how long it took in the results of its projects, and adds
+// its steps to runTimes. Repositories where no project needed updating aren't recorded.
+func (r *runner) recordTimes(opts *Options, repo *repository, results []*Result, runTimes *stepTimes) {
+	times := r.repoTimes
+	r.repoTimes = nil
+
+	elapsed := times.stop()
+	if len(times.order) == 0 || (len(times.order) == 1 && times.order[0] == "scan") {
+		return
+	}
+
+	for _, res := range results {
+		res.Seconds = roundSeconds(elapsed)
+		if opts.Timings {
+			res.Timings = times.seconds()
+		}
+	}
+	runTimes.add(times)
+
+	if opts.Timings {
+		r.printIndentedInfo(repo.Name, "Timings: %s", times)
+	}
+}
+
+// printTimings prints how long the run took, and with detailed set, the total time of each step over all the
+// repositories
+func printTimings(runTimes *stepTimes, detailed bool) {
+	fmt.Printf("\nFinished in %s\n", formatDuration(runTimes.elapsed()))
+	if detailed && len(runTimes.order) > 0 {
+		fmt.Printf("Time per step, slowest first: %s\n", runTimes.slowestFirst())
+	}
+}
+
+// roundSeconds returns the duration in seconds, to the millisecond
+func roundSeconds(d time.Duration) float64 {
+	return math.Round(d.Seconds()*1000) / 1000
+}
+
+// formatDuration rounds the duration to what's useful to read: milliseconds below a second, tenths of a second above
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(100 * time.Millisecond).String()
+}
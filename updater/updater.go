@@ -0,0 +1,2862 @@
+package updater
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/charmbracelet/log"
+	"github.com/ttacon/chalk"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const VersionUnknown = "Unknown"
+const VersionNotFound = "NotFound"
+const VersionLatest = "latest"
+
+// Run updates the dependencies in every project found under the root directories and returns the outcome for each
+// project that uses any of them. The error is ErrAborted if the user quit at a confirmation prompt, the context's
+// error if it was cancelled, or else describes why the run stopped before going through every project.
+// Projects that failed to update are reported in the results, not as an error, unless the run stopped because of them.
+func Run(ctx context.Context, opts *Options) ([]*Result, error) {
+	opts = opts.clone()
+	r, err := setup(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer r.closeLogFile()
+
+	if opts.Matrix != "" {
+		goModPaths, err := r.findProjects(opts)
+		if err != nil {
+			return nil, fmt.Errorf("error walking the path: %v", err)
+		}
+		printVersionMatrix(opts.Matrix, r.versionMatrix(goModPaths, opts.Matrix))
+		return nil, nil
+	}
+
+	// --check and --dry-run only read go.mod, apart from what's needed to find the updates
+	if err := r.setGoBinary(opts, !opts.Check && !opts.DryRun); err != nil {
+		return nil, err
+	}
+	if err := r.resolveLatestVersions(opts); err != nil {
+		return nil, err
+	}
+
+	goModPaths, err := r.findProjects(opts)
+	if err != nil {
+		return nil, fmt.Errorf("error walking the path: %v", err)
+	}
+
+	scans := r.scanProjects(opts, goModPaths)
+	return r.updateProjects(ctx, opts, goModPaths, scans)
+}
+
+// setup validates the options and returns the runner of a run with them, with its own logger
+func setup(ctx context.Context, opts *Options) (*runner, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	r := newRunner(ctx, log.NewWithOptions(os.Stderr, log.Options{ReportTimestamp: true, Level: opts.Level()}))
+	r.setLogFormat(opts.LogFormat)
+	// The log file must be set before the colors, which apply to the log output as set at that point
+	if err := r.setLogFile(opts.LogFile); err != nil {
+		return nil, err
+	}
+	r.setColor(opts.NoColor)
+	r.setCommandTimeouts(opts)
+	r.setNetworkRetries(opts)
+	r.setGoModCache(opts)
+	return r, nil
+}
+
+// updateProjects runs the update pipeline for the projects, one repository at a time, based on their scans.
+// It prints the summary and returns the results as described for Run.
+func (r *runner) updateProjects(ctx context.Context, opts *Options, goModPaths []string, scans map[string]*projectScan) ([]*Result, error) {
+	// Only runs that change projects need the lock, --check and --dry-run can run alongside them
+	if !opts.Check && !opts.DryRun {
+		path, err := lockFile()
+		if err != nil {
+			return nil, err
+		}
+		release, err := acquireLock(path)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+
+	if opts.MaxProjects > 0 {
+		if count := countProjectsToUpdate(scans); count > opts.MaxProjects {
+			if !isTerminal(os.Stdin) {
+				r.logger.Errorf("%d projects need updating, more than --max-projects %d. Check the root directory, or raise --max-projects", count, opts.MaxProjects)
+				return nil, ErrAborted
+			}
+			if r.confirm(yesOrNo, answerNo, "%d projects need updating, more than --max-projects %d. Continue?", count, opts.MaxProjects) != answerYes {
+				return nil, ErrAborted
+			}
+		}
+	}
+
+	var err error
+	var results []*Result
+	usedDependencies := map[string]bool{}
+	runTimes := newStepTimes()
+	// --check only reads go.mod and doesn't need git, every project is reported on its own
+	repos := singleProjectRepositories(goModPaths)
+	if !opts.Check {
+		repos = r.groupByRepository(goModPaths)
+	}
+
+	if !opts.Check {
+		r.progress = newProgress(countRepositoriesToUpdate(repos, scans), r.showLiveProgress(opts), r.logger)
+		defer func() { r.progress = nil }()
+	}
+
+	for _, repo := range repos {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+			break
+		}
+
+		for _, path := range repo.GoModPaths {
+			for _, dependency := range scans[path].usedDependencies {
+				usedDependencies[dependency] = true
+			}
+		}
+
+		if repositoryNeedsUpdate(repo, scans) {
+			r.progress.next(repo.Name)
+		}
+
+		r.repoTimes = newStepTimes()
+		repoResults, updateErr := r.updateRepository(opts, repo, scans)
+		r.recordTimes(opts, repo, repoResults, runTimes)
+		r.progress.finished()
+		results = append(results, repoResults...)
+		if ctx.Err() != nil {
+			for _, res := range repoResults {
+				if strings.HasPrefix(res.Status, StatusFailed) {
+					res.Notes = append(res.Notes, "interrupted")
+				}
+			}
+		}
+		if errors.Is(updateErr, ErrAborted) {
+			err = updateErr
+			break
+		}
+		if updateErr != nil && opts.CollectErrors {
+			r.printIndentedWarning(repo.Name, "Continuing with the next project, the failure is reported at the end (--collect-errors)")
+			continue
+		}
+		if updateErr != nil && opts.KeepGoing {
+			r.printIndentedWarning(repo.Name, "Continuing with the next project (--keep-going): %v", updateErr)
+			continue
+		}
+		if updateErr != nil {
+			err = updateErr
+			break
+		}
+	}
+
+	printSummary(results, opts.Timings)
+	if opts.CollectErrors {
+		printFailureReport(results)
+	}
+	printTimings(runTimes, opts.Timings)
+
+	if err == nil {
+		for _, dependency := range opts.Dependencies {
+			if !usedDependencies[dependency.Module] {
+				r.logger.Warnf("No project under %s requires %s. Is the module path spelled correctly?", strings.Join(opts.RootDirs, ", "), dependency.Module)
+			}
+		}
+	}
+
+	if opts.SummaryJSON != "" {
+		if err := writeSummaryJSON(opts.SummaryJSON, results); err != nil {
+			r.logger.Errorf("Error writing summary to %s: %v", opts.SummaryJSON, err)
+		}
+	}
+
+	return results, err
+}
+
+// FindProjects walks the root directories and returns the path of the go.mod of every project to consider,
+// leaving out skipped and ignored directories and projects not selected with --only.
+func FindProjects(opts *Options) ([]string, error) {
+	return defaultRunner().findProjects(opts)
+}
+
+// findProjects is FindProjects within a run
+func (r *runner) findProjects(opts *Options) ([]string, error) {
+	var goModPaths []string
+	// visited holds the go.mod found at every resolved path, and the root it was found under
+	type found struct{ path, rootDir string }
+	visited := map[string]found{}
+
+	for _, rootDir := range opts.RootDirs {
+		err := filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if info.IsDir() && path != rootDir && shouldSkipDir(rootDir, path, opts.Excludes) {
+				r.logger.Debugf("Skipping directory %s\n", path)
+				return filepath.SkipDir
+			}
+
+			if info.IsDir() && isIgnored(path) {
+				r.logger.Debugf("Skipping %s, it contains a %s file\n", path, ignoreFile)
+				return filepath.SkipDir
+			}
+
+			if info.IsDir() || info.Name() != "go.mod" {
+				return nil
+			}
+
+			// Roots can overlap, or reach the same directory through a symlink, update every project only once
+			if resolved, err := resolvePath(path); err == nil {
+				if first, ok := visited[resolved]; ok {
+					if first.rootDir != rootDir {
+						r.logger.Warnf("Skipping %s, it's the same directory as %s, found under --root %s", filepath.Dir(path), filepath.Dir(first.path), first.rootDir)
+					} else {
+						r.logger.Debugf("Skipping %s, it's the same directory as %s\n", filepath.Dir(path), filepath.Dir(first.path))
+					}
+					return nil
+				}
+				visited[resolved] = found{path: path, rootDir: rootDir}
+			}
+
+			if !isSelectedProject(filepath.Base(filepath.Dir(path)), opts.Only) {
+				r.logger.Debugf("Skipping %s, it doesn't match --only\n", filepath.Dir(path))
+				return nil
+			}
+
+			goModPaths = append(goModPaths, path)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return goModPaths, nil
+}
+
+// resolvePath returns the absolute path with symlinks resolved
+func resolvePath(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(absPath)
+}
+
+// countProjectsToUpdate counts the projects that are behind on any of the dependencies, the go directive or a replacement
+func countProjectsToUpdate(scans map[string]*projectScan) int {
+	count := 0
+	for _, scan := range scans {
+		if len(scan.updates) > 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// projectUpdates returns all updates the go.mod at path needs: dependencies, the go directive and replacements
+func (r *runner) projectUpdates(opts *Options, path string) []PendingUpdate {
+	updates, _ := r.shouldUpgrade(path, opts.Dependencies, opts.AllowDowngrade, opts.Force, opts.OnlyIfCurrent)
+	if opts.Tool {
+		updates = r.toolUpdates(path, updates)
+	}
+	if update, ok := r.goDirectiveUpdate(path, opts.GoVersion); ok {
+		updates = append(updates, update)
+	}
+	updates = append(updates, r.replaceUpdates(path, opts.Replacements)...)
+	return append(updates, r.excludeUpdates(path, opts.ExcludeVersions)...)
+}
+
+// ignoredDirs are directories that never contain projects we want to update
+var ignoredDirs = []string{"vendor", "node_modules", ".git", "testdata"}
+
+// shouldSkipDir reports whether the walk should not descend into dir, either because it's a well-known
+// ignorable directory or because its name or path relative to rootDir matches one of the exclude glob patterns.
+func shouldSkipDir(rootDir, dir string, excludes []string) bool {
+	name := filepath.Base(dir)
+	for _, ignored := range ignoredDirs {
+		if name == ignored {
+			return true
+		}
+	}
+
+	relPath, err := filepath.Rel(rootDir, dir)
+	if err != nil {
+		relPath = dir
+	}
+
+	for _, pattern := range excludes {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+		if matched, _ := filepath.Match(pattern, relPath); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// ignoreFile marks a directory, typically a project, that should never be updated
+const ignoreFile = ".dep-updater-ignore"
+
+// isIgnored reports whether projectDir contains an ignoreFile, in which case it and everything below it is skipped
+func isIgnored(projectDir string) bool {
+	return directoryHasFile(projectDir, ignoreFile)
+}
+
+// isSelectedProject reports whether the project name matches one of the --only glob patterns, or there are none
+func isSelectedProject(projectName string, only []string) bool {
+	if len(only) == 0 {
+		return true
+	}
+
+	for _, pattern := range only {
+		if matched, _ := filepath.Match(pattern, projectName); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// project is a go.mod that is behind on some of the dependencies, along with its entry in the summary
+type project struct {
+	goModPath string
+	dir       string
+	name      string
+	module    string
+	updates   []PendingUpdate
+	res       *Result
+}
+
+// checkProject checks the scan of the project whose go.mod is at goModPath.
+// The returned project is nil if there's nothing to update, and the result is nil if it doesn't use any of the dependencies.
+func (r *runner) checkProject(opts *Options, goModPath string, scan *projectScan) (*project, *Result) {
+	projectDir := filepath.Dir(goModPath)
+	projectName := filepath.Base(projectDir)
+
+	modulePath := scan.module
+	res := &Result{Project: projectName, Module: modulePath, Dir: projectDir}
+
+	updates := scan.updates
+	if len(updates) == 0 {
+		r.logger.Debugf("Upgrade not needed for %s\n", projectDir)
+		if !scan.uses {
+			return nil, nil
+		}
+		return nil, res.skipped(StatusSkippedNotNeeded)
+	}
+
+	res.Updates = updates
+
+	if scan.planChange != "" {
+		r.printIndentedWarning(projectName, "Warning: Project %s changed since the plan was made, %s. Skipping update.", projectName, scan.planChange)
+		res.Notes = append(res.Notes, scan.planChange)
+		return nil, res.skipped(StatusSkippedPlanChanged)
+	}
+
+	if opts.ImportedOnly {
+		imported, err := r.importedModules(projectDir, goModPath, goCommandEnv(opts))
+		if err != nil {
+			r.printIndentedWarning(projectName, "Warning: Could not list the imports of project %s, updating it as if it imports every dependency: %v", projectName, err)
+		} else {
+			var importedUpdates []PendingUpdate
+			for _, update := range updates {
+				if update.Module == goDirective || update.Replacement != "" || update.Exclude || imported[update.Module] {
+					importedUpdates = append(importedUpdates, update)
+					continue
+				}
+				r.logger.Debugf("Not updating %s in %s, none of its packages are imported (--imported-only)", update.Module, projectName)
+			}
+
+			if len(importedUpdates) == 0 {
+				r.printIndentedInfo(projectName, "Skipping %s, it doesn't import any packages of %s (--imported-only)", projectName, describeModules(updates))
+				return nil, res.skipped(StatusSkippedNotImported)
+			}
+			updates = importedUpdates
+			res.Updates = updates
+		}
+	}
+
+	for _, update := range updates {
+		if update.Replacement != "" || update.Exclude {
+			continue
+		}
+
+		replacement, replaced := r.getReplacement(goModPath, update.Module, update.CurrentVersion)
+		if !replaced {
+			continue
+		}
+
+		description := fmt.Sprintf("%s is replaced by %s", update.Module, formatModuleVersion(replacement))
+		if opts.SkipReplaced {
+			r.printIndentedWarning(projectName, "Warning: %s. Skipping update, use --skip-replaced=false to update it anyway.", description)
+			res.Notes = append(res.Notes, description)
+			return nil, res.skipped(StatusSkippedReplaced)
+		}
+
+		r.printIndentedWarning(projectName, "Warning: %s, the replacement stays in effect after the update", description)
+		res.Notes = append(res.Notes, description)
+	}
+
+	if opts.Check {
+		r.printIndentedWarning(projectName, "Out of date: %s", describeUpdates(updates))
+		return nil, res.skipped(StatusOutdated)
+	}
+
+	return &project{goModPath: goModPath, dir: projectDir, name: projectName, module: modulePath, updates: updates, res: res}, res
+}
+
+// importedModules returns the required modules that the packages of the project in projectDir, including their
+// tests, import packages from. Dependencies only required for the sake of other dependencies aren't among them.
+func (r *runner) importedModules(projectDir, goModPath string, env []string) (map[string]bool, error) {
+	out, err := r.executeCommandWithEnv(networkCommand, projectDir, env, r.goBinary, "list", "-e",
+		"-f", `{{join .Imports "\n"}}{{"\n"}}{{join .TestImports "\n"}}{{"\n"}}{{join .XTestImports "\n"}}`, "./...")
+	if err != nil {
+		return nil, err
+	}
+
+	requires, err := r.readRequires(goModPath)
+	if err != nil {
+		return nil, err
+	}
+
+	imported := map[string]bool{}
+	for _, importPath := range strings.Fields(out) {
+		if owner, ok := owningModule(importPath, requires); ok {
+			imported[owner] = true
+		}
+	}
+	return imported, nil
+}
+
+// describeModules lists the modules of the updates
+func describeModules(updates []PendingUpdate) string {
+	modules := make([]string, 0, len(updates))
+	for _, update := range updates {
+		modules = append(modules, update.Module)
+	}
+	return strings.Join(modules, ", ")
+}
+
+// setStatus sets the status of every project
+func setStatus(projects []*project, status string) {
+	for _, p := range projects {
+		p.res.skipped(status)
+	}
+}
+
+// addNote adds the note to the result of every project
+func addNote(projects []*project, note string) {
+	for _, p := range projects {
+		p.res.Notes = append(p.res.Notes, note)
+	}
+}
+
+// failProjects marks the failed project with status and err, and the other projects as failed because of it since
+// they're committed together. If failed is nil, the failure concerns the whole repository and every project gets err.
+func (r *runner) failProjects(projects []*project, failed *project, status string, err error) {
+	for _, p := range projects {
+		if failed == nil || p == failed {
+			p.res.failed(status, err)
+		} else {
+			p.res.failed(StatusFailed, fmt.Errorf("not updated since %s in the same repository failed", failed.name))
+			p.res.Category = classifyFailure(status, err)
+		}
+	}
+}
+
+// failCommitEach marks the failed project, and the other projects that weren't committed yet, as failed with
+// --commit-each. The projects that were already committed keep their commit, which is left unpushed.
+func (r *runner) failCommitEach(projects []*project, committed map[*project]bool, failed *project, err error, branch, featureBranch string) {
+	committedTo := branch
+	if featureBranch != "" {
+		committedTo = featureBranch
+	}
+
+	for _, p := range projects {
+		switch {
+		case committed[p]:
+			p.res.skipped(StatusCommitted)
+			p.res.Notes = append(p.res.Notes, fmt.Sprintf("unpushed commit on %s", committedTo))
+		case p == failed:
+			p.res.failed(StatusFailed, err)
+		default:
+			p.res.failed(StatusFailed, fmt.Errorf("not updated since %s in the same repository failed", failed.name))
+			p.res.Category = classifyFailure(StatusFailed, err)
+		}
+	}
+}
+
+// projectModules returns the module paths of the projects, leaving out those that couldn't be read
+func projectModules(projects []*project) []string {
+	var modules []string
+	for _, p := range projects {
+		if p.module != "" {
+			modules = append(modules, p.module)
+		}
+	}
+	return modules
+}
+
+// combinedUpdates returns the distinct updates of all the projects
+func combinedUpdates(projects []*project) []PendingUpdate {
+	var updates []PendingUpdate
+	seen := map[string]bool{}
+	for _, p := range projects {
+		for _, update := range p.updates {
+			key := update.Module + "@" + update.TargetVersion
+			if !seen[key] {
+				seen[key] = true
+				updates = append(updates, update)
+			}
+		}
+	}
+	return updates
+}
+
+// updateRepository runs the update pipeline for the projects in repo, based on their scans. Every project that needs it is updated and
+// validated on its own, and the changes are committed and pushed together as a single commit.
+// The returned results leave out projects that don't use any of the dependencies.
+// A non-nil error means a project was left in an unwanted state and the whole run should stop.
+func (r *runner) updateRepository(opts *Options, repo *repository, scans map[string]*projectScan) ([]*Result, error) {
+	r.setLogStep("scan")
+
+	var results []*Result
+	var projects []*project
+	for _, goModPath := range repo.GoModPaths {
+		p, res := r.checkProject(opts, goModPath, scans[goModPath])
+		if res != nil {
+			results = append(results, res)
+		}
+		if p != nil {
+			projects = append(projects, p)
+		}
+	}
+	if len(projects) == 0 {
+		return results, nil
+	}
+
+	repoDir, repoName := repo.Dir, repo.Name
+	updates := combinedUpdates(projects)
+
+	if opts.ConfirmBeforeEach {
+		switch r.confirm(allAnswers, answerYes, "Continue with %s?", repoDir) {
+		case answerAll:
+			r.logger.Debugf("Continuing with all remaining projects without asking\n")
+			opts.ConfirmBeforeEach = false
+		case answerQuit:
+			setStatus(projects, StatusSkippedDeclined)
+			return results, ErrAborted
+		case answerNo:
+			r.logger.Debugf("Skipping %s\n", repoDir)
+			setStatus(projects, StatusSkippedDeclined)
+			return results, nil
+		}
+	}
+
+	r.logger.Infof("%sUpdating Project: %s, %s", r.progress.label(), repoName, describeUpdates(updates))
+	if len(projects) > 1 {
+		for _, p := range projects {
+			r.printIndentedInfo(repoName, "Includes project %s", p.dir)
+		}
+	}
+
+	if !r.isGitRepo(repoDir) {
+		if detected, ok := detectVCS(repoDir); ok && detected != gitVCS {
+			r.printIndentedWarning(repoName, "Warning: Project %s is in a %s repository, which is not supported, only git is. Skipping update.", repoName, detected.Name)
+			setStatus(projects, StatusSkippedUnsupportedVCS)
+			return results, nil
+		}
+
+		r.printIndentedWarning(repoName, "Warning: Project %s is not a git repository. Skipping update.", repoName)
+		setStatus(projects, StatusSkippedNotGitRepo)
+		return results, nil
+	}
+
+	if r.isGitOperationInProgress(repoDir) {
+		r.printIndentedWarning(repoName, "Warning: Project %s has a merge, rebase or other git operation in progress. Finish or abort it first. Skipping update.", repoName)
+		setStatus(projects, StatusSkippedInProgress)
+		return results, nil
+	}
+
+	if opts.Since > 0 {
+		lastCommit, err := r.gitLastCommitTime(repoDir)
+		if err != nil {
+			r.printIndentedError(repoName, "Error reading the last commit of project %s: %v", repoName, err)
+			r.failProjects(projects, nil, StatusFailed, err)
+			return results, nil
+		}
+		if time.Since(lastCommit) > opts.Since {
+			r.printIndentedInfo(repoName, "Skipping %s, its last commit is from %s, more than %s ago (--since)", repoName, lastCommit.Format(time.DateOnly), opts.Since)
+			addNote(projects, fmt.Sprintf("last commit %s", lastCommit.Format(time.DateOnly)))
+			setStatus(projects, StatusSkippedStale)
+			return results, nil
+		}
+	}
+
+	remoteConfigured := r.hasRemote(repoDir, opts.Remote)
+	if !remoteConfigured {
+		r.printIndentedWarning(repoName, "Warning: Project %s has no remote named '%s' configured. It will be updated and committed locally, without pulling or pushing.", repoName, opts.Remote)
+	}
+
+	r.setLogStep("check-uncommitted")
+	r.printIndentedInfo(repoName, "Checking for uncommitted changes...")
+	if r.hasUncommittedChanges(repoDir) {
+		if !opts.Stash && !opts.CommitWIP {
+			r.printIndentedWarning(repoName, "Warning: Project %s has uncommitted changes. Skipping update.", repoName)
+			setStatus(projects, StatusSkippedUncommitted)
+			return results, nil
+		}
+
+		// Untracked files may well be secrets or build output, so they're not committed as WIP. Left in place they
+		// could end up in the update commit, e.g. staged by a --pre-commit-cmd.
+		if opts.CommitWIP && r.hasUntrackedFiles(repoDir) {
+			r.printIndentedWarning(repoName, "Warning: Project %s has untracked files, which --commit-wip doesn't commit. Commit, remove or ignore them, or use --stash. Skipping update.", repoName)
+			setStatus(projects, StatusSkippedUncommitted)
+			return results, nil
+		}
+
+		if opts.DryRun && opts.CommitWIP {
+			r.printIndentedInfo(repoName, "Dry run: would commit uncommitted changes as a WIP commit before updating")
+		} else if opts.DryRun {
+			r.printIndentedInfo(repoName, "Dry run: would stash uncommitted changes and restore them afterwards")
+		} else if opts.CommitWIP {
+			r.setLogStep("commit-wip")
+			r.printIndentedInfo(repoName, "Committing uncommitted changes as a WIP commit...")
+			if err := r.gitCommitWIP(repoDir, commitFlags(opts, false)); err != nil {
+				r.printIndentedError(repoName, "Error committing uncommitted changes for project %s: %v", repoName, err)
+				r.failProjects(projects, nil, StatusFailed, err)
+				return results, nil
+			}
+			addNote(projects, "uncommitted changes committed as WIP")
+		} else {
+			r.setLogStep("stash")
+			// The changes are restored on the branch they were made on, not the one the update ends up on
+			originalRef, err := r.gitHeadRef(repoDir)
+			if err != nil {
+				r.printIndentedError(repoName, "Error determining current branch for project %s: %v", repoName, err)
+				r.failProjects(projects, nil, StatusFailed, err)
+				return results, nil
+			}
+
+			r.printIndentedInfo(repoName, "Stashing uncommitted changes...")
+			if err := r.gitStash(repoDir); err != nil {
+				r.printIndentedError(repoName, "Error stashing uncommitted changes for project %s: %v", repoName, err)
+				r.failProjects(projects, nil, StatusFailed, err)
+				return results, nil
+			}
+
+			defer func() {
+				if current, err := r.currentGitBranch(repoDir); err != nil || current != originalRef {
+					r.printIndentedInfo(repoName, "Switching back to %s...", originalRef)
+					if err := r.gitSwitchBack(repoDir, originalRef); err != nil {
+						r.printIndentedError(repoName, "Error switching back to %s for project %s, the uncommitted changes are left in the stash. Switch to it and run 'git stash pop' to restore them: %v", originalRef, repoName, err)
+						addNote(projects, "stashed changes could not be restored")
+						return
+					}
+				}
+
+				r.printIndentedInfo(repoName, "Restoring stashed changes...")
+				if err := r.gitStashPop(repoDir); err != nil {
+					r.printIndentedError(repoName, "Error restoring stashed changes for project %s, they are left in the stash. Resolve the conflicts and run 'git stash drop', or restore them with 'git stash pop': %v", repoName, err)
+					addNote(projects, "stashed changes could not be restored")
+				}
+			}()
+		}
+	}
+
+	branch := opts.Branch
+	if branch == "" {
+		detected, err := r.defaultBranch(repoDir, opts.Remote)
+		if err != nil {
+			r.printIndentedError(repoName, "Error determining default branch for project %s: %v", repoName, err)
+			r.failProjects(projects, nil, StatusFailed, err)
+			return results, nil
+		}
+		branch = detected
+	}
+
+	if !r.gitBranchExists(repoDir, opts.Remote, branch) {
+		r.printIndentedWarning(repoName, "Warning: Project %s has no branch named '%s'. Skipping update.", repoName, branch)
+		setStatus(projects, StatusSkippedNoBranch)
+		return results, nil
+	}
+
+	if opts.DryRun {
+		r.printIndentedInfo(repoName, "Dry run: would switch to '%s' and pull latest from %s", branch, opts.Remote)
+		for _, p := range projects {
+			for _, update := range p.updates {
+				if update.Module == goDirective {
+					r.printIndentedInfo(p.name, "Dry run: would run go mod edit -go=%s", update.TargetVersion)
+				}
+				if update.Replacement != "" {
+					r.printIndentedInfo(p.name, "Dry run: would run go mod edit -replace=%s", update.replaceArg())
+				}
+				if update.Exclude {
+					r.printIndentedInfo(p.name, "Dry run: would run go mod edit -exclude=%s@%s", update.Module, update.TargetVersion)
+				}
+			}
+			if args := goGetArgs(p.updates); len(args) > 0 && opts.NoTidy {
+				r.printIndentedInfo(p.name, "Dry run: would run go get %s without go mod tidy", strings.Join(append(goGetFlags(opts), args...), " "))
+			} else if len(args) > 0 {
+				r.printIndentedInfo(p.name, "Dry run: would run go get %s and go mod %s", strings.Join(append(goGetFlags(opts), args...), " "), strings.Join(append([]string{"tidy"}, goModTidyFlags(opts)...), " "))
+			}
+		}
+		if opts.VerifyCommand != "" {
+			r.printIndentedInfo(repoName, "Dry run: would run %s instead of go vet, go test and go build", opts.VerifyCommand)
+		} else if skipped := opts.skippedChecks(); len(skipped) > 0 {
+			r.printIndentedInfo(repoName, "Dry run: would not run go %s", strings.Join(skipped, ", go "))
+		} else {
+			r.printIndentedInfo(repoName, "Dry run: would run go vet, go test and go build")
+		}
+		if opts.NoPush {
+			r.printIndentedInfo(repoName, "Dry run: would commit without pushing")
+		} else if opts.PullRequest {
+			r.printIndentedInfo(repoName, "Dry run: would commit to '%s', push it and open a %s", featureBranchName(updates, opts.BaseRef), opts.changeRequestName())
+			if opts.BaseRef != "" {
+				r.printIndentedInfo(repoName, "Dry run: would create the branch from %s", opts.BaseRef)
+			}
+		} else {
+			r.printIndentedInfo(repoName, "Dry run: would commit and push to %s", opts.Remote)
+		}
+		if opts.TagBump != "" {
+			r.printIndentedInfo(repoName, "Dry run: would tag the commit with the next %s version", opts.TagBump)
+		}
+		setStatus(projects, StatusDryRun)
+		return results, nil
+	}
+
+	r.setLogStep("checkout")
+	r.printIndentedInfo(repoName, "Checking that current git branch is %s...", branch)
+	currentBranch, err := r.currentGitBranch(repoDir)
+	if err != nil {
+		r.printIndentedError(repoName, "Error determining current branch for project %s: %v", repoName, err)
+		r.failProjects(projects, nil, StatusFailed, err)
+		return results, nil
+	}
+
+	if currentBranch != branch {
+		r.printIndentedInfo(repoName, "Project is not on '%s' branch. Switching...", branch)
+
+		err := r.gitCheckout(repoDir, branch)
+		if err != nil {
+			r.printIndentedError(repoName, "Error switching to '%s' branch for project %s: %v", branch, repoName, err)
+			r.failProjects(projects, nil, StatusFailed, err)
+			return results, nil
+		}
+	}
+
+	if remoteConfigured {
+		r.setLogStep("pull")
+		r.printIndentedInfo(repoName, "Pulling latest from %s...", opts.Remote)
+		if err := r.gitPull(repoDir, opts.Remote, branch, opts.PullStrategy); err != nil {
+			r.printIndentedError(repoName, "Error pulling changes for project %s: %v", repoName, err)
+			r.failProjects(projects, nil, StatusFailed, err)
+			return results, nil
+		}
+	}
+
+	featureBranch, baseBranch := "", branch
+	keepFeatureBranch := false
+	if opts.PullRequest {
+		featureBranch = featureBranchName(updates, opts.BaseRef)
+
+		startPoint := ""
+		if opts.BaseRef != "" {
+			r.setLogStep("base-ref")
+			if startPoint, err = r.resolveBaseRef(repoDir, opts.Remote, opts.BaseRef, remoteConfigured); err != nil {
+				r.printIndentedError(repoName, "Error finding --base-ref %s for project %s: %v", opts.BaseRef, repoName, err)
+				r.failProjects(projects, nil, StatusFailed, err)
+				return results, nil
+			}
+			if r.gitBranchExists(repoDir, opts.Remote, opts.BaseRef) {
+				baseBranch = opts.BaseRef
+			}
+		}
+
+		r.setLogStep("create-branch")
+		// A branch of the same name is left by an earlier run, e.g. with --no-push, and may have commits on it that
+		// are meant to be kept, so it's never reset or deleted
+		if r.gitRefExists(repoDir, "refs/heads/"+featureBranch) {
+			r.printIndentedWarning(repoName, "Warning: Project %s already has a branch named '%s', left by an earlier run. Push or delete it first. Skipping update.", repoName, featureBranch)
+			setStatus(projects, StatusSkippedBranchExists)
+			return results, nil
+		}
+		if startPoint != "" {
+			r.printIndentedInfo(repoName, "Creating branch %s from %s...", featureBranch, startPoint)
+		} else {
+			r.printIndentedInfo(repoName, "Creating branch %s...", featureBranch)
+		}
+		if err := r.gitCreateBranch(repoDir, featureBranch, startPoint); err != nil {
+			r.printIndentedError(repoName, "Error creating branch %s for project %s: %v", featureBranch, repoName, err)
+			r.failProjects(projects, nil, StatusFailed, err)
+			return results, nil
+		}
+
+		// Whatever happens from here, switch back to the branch. The feature branch was created by this run, so it's
+		// only kept if the update was pushed on it, or deliberately left on it unpushed, so a failed update doesn't
+		// block the next run.
+		defer func() {
+			if keepFeatureBranch {
+				if err := r.gitCheckout(repoDir, branch); err != nil {
+					r.printIndentedWarning(repoName, "Warning: Could not switch back to '%s' branch for project %s: %v", branch, repoName, err)
+				}
+				return
+			}
+			r.abandonFeatureBranch(repoName, repoDir, branch, featureBranch)
+		}()
+
+		// The projects were checked on the branch, the base ref may be on other versions or not have them at all
+		if startPoint != "" {
+			remaining := projects[:0:0]
+			for _, p := range projects {
+				if !directoryHasFile(p.dir, "go.mod") {
+					r.printIndentedInfo(p.name, "Project %s doesn't exist at %s, skipping it", p.name, opts.BaseRef)
+					p.res.skipped(StatusSkippedNotNeeded)
+					p.res.Notes = append(p.res.Notes, fmt.Sprintf("not in %s", opts.BaseRef))
+					continue
+				}
+				if p.updates = r.projectUpdates(opts, p.goModPath); len(p.updates) == 0 {
+					r.printIndentedInfo(p.name, "Project %s needs no update at %s, skipping it", p.name, opts.BaseRef)
+					p.res.Updates = nil
+					p.res.skipped(StatusSkippedNotNeeded)
+					continue
+				}
+				p.res.Updates = p.updates
+				remaining = append(remaining, p)
+			}
+			if projects = remaining; len(projects) == 0 {
+				return results, nil
+			}
+			updates = combinedUpdates(projects)
+		}
+	}
+
+	// From here until the commit, go.mod and go.sum may be modified. Restore them if the update fails on the way.
+	uncommittedUpdate := true
+	committed := map[*project]bool{}
+	defer func() {
+		if !uncommittedUpdate || !opts.RollbackOnFailure {
+			return
+		}
+
+		for _, p := range projects {
+			// With --commit-each, the projects committed before one failed to commit keep their commit
+			if committed[p] {
+				continue
+			}
+			r.printIndentedInfo(p.name, "Rolling back changes to go.mod and go.sum...")
+			if err := r.rollbackDependencyFiles(p.dir); err != nil {
+				r.printIndentedError(p.name, "Error rolling back go.mod and go.sum for project %s: %v", p.name, err)
+				p.res.Notes = append(p.res.Notes, "rollback failed")
+			}
+		}
+	}()
+
+	for _, p := range projects {
+		if status, err := r.updateDependencyFiles(opts, p); err != nil {
+			r.failProjects(projects, p, status, err)
+			return results, nil
+		}
+	}
+
+	// With --force the dependencies may already be at the target version, and go get and go mod tidy may well leave
+	// go.mod and go.sum as they were. There's nothing to commit for those projects.
+	changed := projects[:0:0]
+	for _, p := range projects {
+		dirty, err := r.gitDependencyFilesChanged(p.dir)
+		if err != nil {
+			r.printIndentedError(p.name, "Error checking for changes to go.mod and go.sum for project %s: %v", p.name, err)
+			r.failProjects(projects, p, StatusFailed, err)
+			return results, nil
+		}
+		if !dirty {
+			r.printIndentedInfo(p.name, "go.mod and go.sum are unchanged, nothing to commit for %s", p.name)
+			p.res.Status = StatusUnchanged
+			continue
+		}
+		changed = append(changed, p)
+	}
+	if projects = changed; len(projects) == 0 {
+		return results, nil
+	}
+	updates = combinedUpdates(projects)
+
+	if opts.ShowDiff || opts.ConfirmBeforeEach {
+		for _, p := range projects {
+			diff, err := r.gitDiffDependencyFiles(p.dir)
+			if err != nil {
+				r.printIndentedError(p.name, "Error showing the changes to go.mod and go.sum for project %s: %v", p.name, err)
+				r.failProjects(projects, p, StatusFailed, err)
+				return results, nil
+			}
+			r.printDiff(diff)
+		}
+
+		if opts.ConfirmBeforeEach {
+			switch r.confirm(allAnswers, answerYes, "Commit these changes to %s?", repoName) {
+			case answerAll:
+				opts.ConfirmBeforeEach = false
+			case answerQuit:
+				setStatus(projects, StatusSkippedDeclined)
+				return results, ErrAborted
+			case answerNo:
+				r.printIndentedInfo(repoName, "Not committing the changes to %s", repoName)
+				setStatus(projects, StatusSkippedDeclined)
+				return results, nil
+			}
+		}
+	}
+
+	for _, p := range projects {
+		if status, err := r.runPreCommitCommands(opts, p); err != nil {
+			r.failProjects(projects, p, status, err)
+			return results, nil
+		}
+	}
+
+	if skipped := opts.skippedChecks(); len(skipped) > 0 {
+		r.printIndentedWarning(repoName, "Not running go %s, the update is committed without being validated by them", strings.Join(skipped, ", go "))
+		addNote(projects, fmt.Sprintf("unvalidated, skipped go %s", strings.Join(skipped, ", go ")))
+	}
+
+	for _, p := range projects {
+		if status, err := r.validateProject(opts, p); err != nil {
+			r.failProjects(projects, p, status, err)
+			return results, fmt.Errorf("aborted due to unwanted project state after update. See above error(s)")
+		}
+	}
+
+	commitMessage, err := formatCommitMessage(opts.CommitMessage, repoName, projectModules(projects), updates)
+	if err != nil {
+		r.printIndentedError(repoName, "Error rendering commit message for project %s: %v", repoName, err)
+		r.failProjects(projects, nil, StatusFailed, err)
+		return results, nil
+	}
+
+	r.setLogStep("commit")
+	amend := false
+	message := commitMessage
+	if opts.Amend {
+		// Marks the commit, so the next run with --amend can fold its update into it
+		message = withCommitTrailer(commitMessage)
+	}
+	commitEach := opts.CommitEach && len(projects) > 1
+	if opts.Amend && commitEach {
+		r.printIndentedInfo(repoName, "Not amending the last commit with --commit-each, creating a commit for each project instead")
+	} else if opts.Amend {
+		previous, err := r.gitHeadMessage(repoDir)
+		switch {
+		case err != nil || !isDepUpdateCommit(previous):
+			r.printIndentedInfo(repoName, "The last commit wasn't made by go-dep-updater, creating a new commit instead of amending it")
+		case r.gitHeadIsPushed(repoDir):
+			r.printIndentedWarning(repoName, "Warning: The last commit was made by go-dep-updater but is already pushed, creating a new commit instead of amending it")
+		default:
+			amend = true
+			// The trailers of the last commit are dropped, --signoff and --trailer add theirs to the new message again
+			body, _ := splitTrailers(previous)
+			message = withCommitTrailer(body + "\n\n" + commitMessage)
+		}
+	}
+
+	if commitEach {
+		for _, p := range projects {
+			projectMessage, err := formatCommitMessage(opts.CommitMessage, p.name, projectModules([]*project{p}), p.updates)
+			if err != nil {
+				r.printIndentedError(p.name, "Error rendering commit message for project %s: %v", p.name, err)
+				r.failCommitEach(projects, committed, p, err, branch, featureBranch)
+				keepFeatureBranch = len(committed) > 0
+				return results, nil
+			}
+
+			r.printIndentedInfo(p.name, "Committing changes to %s to git...", p.dir)
+			if err := r.gitCommitProject(repoDir, p.dir, repo.GoModPaths, projectMessage, commitFlags(opts, false)); err != nil {
+				r.printIndentedError(p.name, "Error committing changes for project %s: %v", p.name, err)
+				r.failCommitEach(projects, committed, p, err, branch, featureBranch)
+				keepFeatureBranch = len(committed) > 0
+				return results, nil
+			}
+			committed[p] = true
+		}
+	} else {
+		projectDirs := make([]string, 0, len(projects))
+		for _, p := range projects {
+			projectDirs = append(projectDirs, p.dir)
+		}
+
+		if amend {
+			r.printIndentedInfo(repoName, "Amending the last commit with the changes...")
+		} else {
+			r.printIndentedInfo(repoName, "Committing changes to git...")
+		}
+		if err := r.gitCommit(repoDir, projectDirs, message, commitFlags(opts, amend)); err != nil {
+			r.printIndentedError(repoName, "Error committing changes for project %s: %v", repoName, err)
+			r.failProjects(projects, nil, StatusFailed, err)
+			return results, nil
+		}
+	}
+	uncommittedUpdate = false
+
+	setStatus(projects, StatusUpdated)
+
+	pushDeclined, quit := false, false
+	if opts.ConfirmPush && !opts.NoPush && remoteConfigured {
+		commits := 1
+		if commitEach {
+			commits = len(projects)
+		}
+		if commit, err := r.gitShowLastCommits(repoDir, commits); err != nil {
+			r.printIndentedWarning(repoName, "Warning: Could not show the commit for project %s: %v", repoName, err)
+		} else {
+			r.printDiff(commit)
+		}
+
+		switch r.confirm(allAnswers, answerNo, "Push this commit for %s to %s?", repoName, opts.Remote) {
+		case answerAll:
+			opts.ConfirmPush = false
+		case answerQuit:
+			pushDeclined, quit = true, true
+		case answerNo:
+			pushDeclined = true
+		}
+	}
+
+	pushed := !opts.NoPush && remoteConfigured && !pushDeclined
+	if !pushed {
+		committedTo := branch
+		if opts.PullRequest {
+			committedTo = featureBranch
+		}
+		if pushDeclined {
+			r.printIndentedInfo(repoName, "Not pushing, the commit is left on '%s'", committedTo)
+		} else if remoteConfigured {
+			r.printIndentedInfo(repoName, "Not pushing (--no-push), the commit is left on '%s'", committedTo)
+		} else {
+			r.printIndentedInfo(repoName, "Not pushing since there is no '%s' remote, the commit is left on '%s'", opts.Remote, committedTo)
+		}
+		setStatus(projects, StatusCommitted)
+		addNote(projects, fmt.Sprintf("unpushed commit on %s", committedTo))
+		keepFeatureBranch = true
+	} else if opts.PullRequest {
+		r.setLogStep("push")
+		r.printIndentedInfo(repoName, "Pushing branch %s to %s...", featureBranch, opts.Remote)
+		if err := r.gitPush(repoDir, opts.Remote, featureBranch); err != nil {
+			r.printIndentedError(repoName, "Error pushing branch %s for project %s: %v", featureBranch, repoName, err)
+			r.failProjects(projects, nil, StatusFailed, err)
+			return results, nil
+		}
+		keepFeatureBranch = true
+
+		r.setLogStep("pull-request")
+		r.printIndentedInfo(repoName, "Opening %s...", opts.changeRequestName())
+		title, body := strings.SplitN(commitMessage, "\n", 2)[0], pullRequestBody(opts.changeRequestName(), projectModules(projects), updates)
+		openChangeRequest := r.openPullRequest
+		if opts.Platform == PlatformGitLab {
+			openChangeRequest = func(projectDir, baseBranch, branch, title, body string) error {
+				return r.openMergeRequest(projectDir, baseBranch, branch, title, body, opts.GitLabToken)
+			}
+		} else if opts.GitHubToken != "" {
+			baseURL := opts.GitHubBaseURL
+			if baseURL == "" {
+				baseURL = DefaultGitHubBaseURL
+			}
+			openChangeRequest = func(projectDir, baseBranch, branch, title, body string) error {
+				pullRequestURL, err := r.openPullRequestWithAPI(projectDir, opts.Remote, baseURL, opts.GitHubToken, baseBranch, branch, title, body)
+				if err == nil && pullRequestURL != "" {
+					r.printIndentedInfo(repoName, "Opened pull request %s", pullRequestURL)
+				}
+				return err
+			}
+		}
+		if err := openChangeRequest(repoDir, baseBranch, featureBranch, title, body); err != nil {
+			r.printIndentedError(repoName, "Error opening %s for project %s: %v", opts.changeRequestName(), repoName, err)
+			r.failProjects(projects, nil, StatusFailed, err)
+			return results, nil
+		}
+	} else {
+		r.setLogStep("push")
+		r.printIndentedInfo(repoName, "Pushing to %s...", opts.Remote)
+		if err := r.gitPush(repoDir, opts.Remote, branch); err != nil {
+			r.printIndentedError(repoName, "Error pushing changes for project %s: %v", repoName, err)
+			r.failProjects(projects, nil, StatusFailed, err)
+			return results, nil
+		}
+	}
+
+	if opts.TagBump != "" {
+		r.setLogStep("tag")
+		for _, p := range projects {
+			tag, err := r.tagRelease(opts, p, pushed)
+			switch {
+			case tag == "":
+				r.printIndentedWarning(p.name, "Warning: Could not tag project %s: %v", p.name, err)
+				p.res.Notes = append(p.res.Notes, "tagging failed")
+			case err != nil:
+				r.printIndentedWarning(p.name, "Warning: Could not push tag %s for project %s: %v", tag, p.name, err)
+				p.res.Notes = append(p.res.Notes, fmt.Sprintf("tagged %s locally, pushing the tag failed", tag))
+			case pushed:
+				r.printIndentedInfo(p.name, "Tagged and pushed %s", tag)
+				p.res.Notes = append(p.res.Notes, fmt.Sprintf("tagged %s", tag))
+			default:
+				r.printIndentedInfo(p.name, "Tagged %s, the tag is left unpushed", tag)
+				p.res.Notes = append(p.res.Notes, fmt.Sprintf("tagged %s locally", tag))
+			}
+		}
+	}
+
+	if pushed && opts.NotifyURL != "" {
+		r.setLogStep("notify")
+		for _, p := range projects {
+			if err := r.notify(opts.NotifyURL, p.res); err != nil {
+				r.printIndentedWarning(p.name, "Warning: Could not send the notification for project %s: %v", p.name, err)
+				p.res.Notes = append(p.res.Notes, "notification failed")
+			}
+		}
+	}
+
+	r.printIndentedInfo(repoName, "Done updating %s in %s", repoName, formatDuration(r.repoTimes.elapsed()))
+	if quit {
+		return results, ErrAborted
+	}
+	return results, nil
+}
+
+// updateDependencyFiles runs go get for the project's updates, and go mod verify with --verify.
+// On failure it returns the status to report along with the error.
+func (r *runner) updateDependencyFiles(opts *Options, p *project) (string, error) {
+	goGetEnv := projectGoEnv(opts, p.dir)
+	if workspaceRoot, ok := findWorkspaceRoot(p.dir); ok {
+		r.printIndentedInfo(p.name, "Project is part of the workspace at %s, updating it as a standalone module (GOWORK=off)", workspaceRoot)
+	}
+
+	before, beforeErr := r.readRequires(p.goModPath)
+
+	r.setLogStep("go-get")
+	r.printIndentedInfo(p.name, "Running go get...")
+	if err := r.goGetUpdate(p.dir, p.updates, goGetFlags(opts), !opts.NoTidy, goModTidyFlags(opts), goGetEnv); err != nil {
+		r.printIndentedError(p.name, "Error updating dependency for project %s: %v", p.name, err)
+		return StatusFailed, err
+	}
+	if opts.NoTidy {
+		r.printIndentedWarning(p.name, "Warning: Skipped go mod tidy (--no-tidy), go.sum may be incomplete and go.mod may keep requirements that are no longer needed")
+		p.res.Notes = append(p.res.Notes, "not tidied")
+	}
+
+	r.printIndentedInfo(p.name, "Successfully updated %s for %s", describeUpdates(p.updates), p.name)
+
+	if after, err := r.readRequires(p.goModPath); err == nil && beforeErr == nil {
+		p.res.OtherChanges = requirementChanges(before, after, p.updates)
+		if count := len(p.res.OtherChanges); count > 0 {
+			r.printIndentedInfo(p.name, "go get and go mod tidy changed %d other requirement(s) along with the update", count)
+			for _, change := range p.res.OtherChanges {
+				r.logger.Debugf("%s: %s", p.name, change)
+			}
+			p.res.Notes = append(p.res.Notes, fmt.Sprintf("%d other requirement(s) changed", count))
+		}
+	}
+
+	// go get succeeding doesn't guarantee the update took effect, make sure go.mod has it
+	unconfirmed, err := r.checkUpdatesApplied(p.goModPath, p.updates)
+	if err != nil {
+		r.printIndentedError(p.name, "Error: The update didn't take effect for project %s: %v", p.name, err)
+		return StatusFailedNotApplied, err
+	}
+	verified := len(unconfirmed) == 0
+	p.res.Verified = &verified
+	for _, reason := range unconfirmed {
+		r.printIndentedWarning(p.name, "Warning: Could not verify the update for project %s, %s", p.name, reason)
+	}
+	if !verified {
+		p.res.Notes = append(p.res.Notes, "unverified")
+	}
+
+	if opts.Verify {
+		r.setLogStep("verify")
+		r.printIndentedInfo(p.name, "Running go mod verify...")
+		if out, err := r.goModVerify(p.dir, goGetEnv); err != nil {
+			r.printIndentedError(p.name, "Error verifying module checksums for project %s, the module cache may be corrupted or tampered with: %v", p.name, err)
+			for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+				if line != "" {
+					r.printIndentedError(p.name, "  %s", line)
+				}
+			}
+			return StatusFailed, err
+		}
+	}
+	return "", nil
+}
+
+// checkUpdatesApplied re-reads the go.mod at path after updating, and returns an error for the first update that
+// isn't in it. The go directive must be at least the target version, a requirement exactly at it, and replace and
+// exclude directives must be there. It also returns the reasons updates that are in go.mod may not take effect,
+// when a replace directive decides the version of the module instead of its requirement.
+func (r *runner) checkUpdatesApplied(path string, updates []PendingUpdate) ([]string, error) {
+	file, err := r.readGoMod(path)
+	if err != nil {
+		return nil, err
+	}
+
+	requires := map[string]string{}
+	for _, require := range file.Requires {
+		requires[require.Path] = require.Version
+	}
+
+	var unconfirmed []string
+	for _, update := range updates {
+		switch {
+		case update.Module == goDirective:
+			if file.Go == "" || semver.Compare("v"+file.Go, "v"+update.TargetVersion) < 0 {
+				return nil, fmt.Errorf("the go directive is still below %s", update.TargetVersion)
+			}
+		case update.Exclude:
+			if !isExcluded(file.Excludes, update.Module, update.TargetVersion) {
+				return nil, fmt.Errorf("%s %s isn't excluded", update.Module, update.TargetVersion)
+			}
+		case update.Replacement != "":
+			if replacement, ok := r.getReplacement(path, update.Module, requires[update.Module]); !ok || replacement.Path != update.Replacement || replacement.Version != update.TargetVersion {
+				return nil, fmt.Errorf("%s isn't replaced with %s %s", update.Module, update.Replacement, update.TargetVersion)
+			}
+		default:
+			version, ok := requires[update.Module]
+			if !ok {
+				return nil, fmt.Errorf("%s is no longer required, go mod tidy removed it", update.Module)
+			}
+			switch {
+			case version == update.TargetVersion || sameRevision(version, update.TargetVersion):
+			case !semver.IsValid(update.TargetVersion):
+				// A branch name or other query resolves to a version that can't be told apart from another one
+				unconfirmed = append(unconfirmed, fmt.Sprintf("%s %s resolved to %s", update.Module, update.TargetVersion, version))
+			default:
+				return nil, fmt.Errorf("%s is at %s instead of %s", update.Module, version, update.TargetVersion)
+			}
+			if replacement, ok := r.getReplacement(path, update.Module, version); ok {
+				unconfirmed = append(unconfirmed, fmt.Sprintf("%s is replaced with %s", update.Module, formatModuleVersion(replacement)))
+			}
+		}
+	}
+	return unconfirmed, nil
+}
+
+// requirementChanges compares the requirements of go.mod before and after the updates, and returns the changes
+// besides the updates themselves, sorted by module
+func requirementChanges(before, after []module.Version, updates []PendingUpdate) []RequirementChange {
+	updated := map[string]bool{}
+	for _, update := range updates {
+		updated[update.Module] = true
+	}
+
+	versions := map[string]*RequirementChange{}
+	for _, require := range before {
+		versions[require.Path] = &RequirementChange{Module: require.Path, OldVersion: require.Version}
+	}
+	for _, require := range after {
+		if change, ok := versions[require.Path]; ok {
+			change.NewVersion = require.Version
+		} else {
+			versions[require.Path] = &RequirementChange{Module: require.Path, NewVersion: require.Version}
+		}
+	}
+
+	var changes []RequirementChange
+	for _, change := range versions {
+		if !updated[change.Module] && change.OldVersion != change.NewVersion {
+			changes = append(changes, *change)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Module < changes[j].Module
+	})
+	return changes
+}
+
+// runPreCommitCommands runs the --pre-commit commands in the project's directory and stages what they change
+func (r *runner) runPreCommitCommands(opts *Options, p *project) (string, error) {
+	if len(opts.PreCommitCommands) == 0 {
+		return "", nil
+	}
+
+	// Only the files the commands change are staged, not whatever else happens to be in the project, like untracked
+	// files that were there before
+	before, err := r.gitFileStates(p.dir)
+	if err != nil {
+		r.printIndentedError(p.name, "Error reading the git status of project %s: %v", p.name, err)
+		return StatusFailed, err
+	}
+
+	for _, command := range opts.PreCommitCommands {
+		r.setLogStep("pre-commit")
+		r.printIndentedInfo(p.name, "Running pre-commit command: %s...", command)
+		out, err := r.runPreCommitCommand(p.dir, command)
+		for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+			if line != "" {
+				r.printIndentedInfo(p.name, "  %s", line)
+			}
+		}
+		if err != nil {
+			r.printIndentedError(p.name, "Error running pre-commit command '%s' for project %s: %v", command, p.name, err)
+			return StatusFailed, err
+		}
+	}
+
+	after, err := r.gitFileStates(p.dir)
+	if err == nil {
+		err = r.gitAddFiles(p.dir, changedFiles(before, after))
+	}
+	if err != nil {
+		r.printIndentedError(p.name, "Error staging changes from pre-commit commands for project %s: %v", p.name, err)
+		return StatusFailed, err
+	}
+	return "", nil
+}
+
+// validateProject runs go vet, go test and go build for the project, except the ones skipped by the options,
+// or the --verify-cmd instead of them
+func (r *runner) validateProject(opts *Options, p *project) (string, error) {
+	env := projectGoEnv(opts, p.dir)
+
+	if opts.VerifyCommand != "" {
+		r.setLogStep("verify-cmd")
+		r.printIndentedInfo(p.name, "Running verification command: %s...", opts.VerifyCommand)
+		if err := r.runVerifyCommand(p.dir, opts.VerifyCommand, env); err != nil {
+			r.printIndentedError(p.name, "Error running verification command '%s' for project %s: %v", opts.VerifyCommand, p.name, err)
+			return StatusFailedVerify, err
+		}
+		return "", nil
+	}
+
+	if !opts.SkipVet {
+		r.setLogStep("vet")
+		r.printIndentedInfo(p.name, "Running go vet...")
+		if err := r.goVet(p.dir, opts.VetArgs, env); err != nil {
+			r.printIndentedError(p.name, "Error running go vet for project %s: %v", p.name, err)
+			return StatusFailedVet, err
+		}
+	}
+
+	if !opts.SkipTest {
+		r.setLogStep("test")
+		r.printIndentedInfo(p.name, "Running go test...")
+		if err := r.goTest(p.dir, opts.TestArgs, env); err != nil {
+			r.printIndentedError(p.name, "Error running go test for project %s: %v", p.name, err)
+			return StatusFailedTests, err
+		}
+	}
+
+	if !opts.SkipBuild {
+		r.setLogStep("build")
+		r.printIndentedInfo(p.name, "Running go build...")
+		if err := r.goBuild(p.dir, env); err != nil {
+			r.printIndentedError(p.name, "Error running go build for project %s: %v", p.name, err)
+			return StatusFailedBuild, err
+		}
+	}
+	return "", nil
+}
+
+// PendingUpdate is a dependency in a specific project that is not yet at the requested version
+type PendingUpdate struct {
+	Module         string `json:"module"`
+	CurrentVersion string `json:"currentVersion"`
+	TargetVersion  string `json:"targetVersion"`
+	// Replacement is the module that replaces Module at TargetVersion, for updates that add a replace directive
+	Replacement string `json:"replacement,omitempty"`
+	// Exclude is set for updates that add an exclude directive for Module at TargetVersion
+	Exclude bool `json:"exclude,omitempty"`
+	// Tools are the packages of Module in the tool directives of go.mod, for updates made with go get -tool
+	Tools []string `json:"tools,omitempty"`
+}
+
+// target describes what the update changes the module to: a version, a replacement, or a version to exclude
+func (u PendingUpdate) target() string {
+	if u.Replacement != "" {
+		return fmt.Sprintf("=> %s %s", u.Replacement, u.TargetVersion)
+	}
+	if u.Exclude {
+		return fmt.Sprintf("exclude %s", u.TargetVersion)
+	}
+	return u.TargetVersion
+}
+
+// replaceArg returns the argument for go mod edit -replace that adds the update's replacement
+func (u PendingUpdate) replaceArg() string {
+	return fmt.Sprintf("%s=%s@%s", u.Module, u.Replacement, u.TargetVersion)
+}
+
+// ShouldUpgrade returns the dependencies in the go.mod at path that need updating,
+// and whether there is at least one of them.
+func ShouldUpgrade(path string, dependencies []DependencyUpdate, allowDowngrade, force bool, onlyIfCurrent VersionConstraint) (updates []PendingUpdate, upgrade bool) {
+	return defaultRunner().shouldUpgrade(path, dependencies, allowDowngrade, force, onlyIfCurrent)
+}
+
+// ShouldUpgradeVersion reports whether a module required at the current version needs updating to the requested one,
+// with the options' AllowDowngrade, Force and OnlyIfCurrent. It only compares the versions, without reading or
+// logging anything.
+func ShouldUpgradeVersion(current, requested string, opts *Options) bool {
+	upgrade, _ := upgradeDecision(current, requested, opts.AllowDowngrade, opts.Force, opts.OnlyIfCurrent)
+	return upgrade
+}
+
+// shouldUpgrade is ShouldUpgrade within a run
+func (r *runner) shouldUpgrade(path string, dependencies []DependencyUpdate, allowDowngrade, force bool, onlyIfCurrent VersionConstraint) (updates []PendingUpdate, upgrade bool) {
+	requires, err := r.readRequires(path)
+	if err != nil {
+		r.logger.Debugf("Failed to parse %s: %v", path, err)
+	}
+
+	updates = r.pendingUpdates(path, requires, dependencies, allowDowngrade, force, onlyIfCurrent)
+	return updates, len(updates) > 0
+}
+
+// pendingUpdates returns the required module versions that need updating to reach the dependencies' versions, as
+// decided by upgradeDecision. The path of go.mod is only logged.
+func (r *runner) pendingUpdates(path string, requires []module.Version, dependencies []DependencyUpdate, allowDowngrade, force bool, onlyIfCurrent VersionConstraint) []PendingUpdate {
+	var updates []PendingUpdate
+	seen := map[string]bool{}
+
+	for _, dependency := range dependencies {
+		for _, required := range requiresMatching(requires, dependency.Module) {
+			if seen[required.Path] {
+				continue
+			}
+			seen[required.Path] = true
+
+			upgrade, reason := upgradeDecision(required.Version, dependency.Version, allowDowngrade, force, onlyIfCurrent)
+			if reason != "" {
+				r.logger.Debugf("Not updating %s in %s, %s", required.Path, path, reason)
+			}
+			if upgrade {
+				updates = append(updates, PendingUpdate{
+					Module:         required.Path,
+					CurrentVersion: required.Version,
+					TargetVersion:  dependency.Version,
+				})
+			}
+		}
+	}
+	return updates
+}
+
+// goDirective is the Module of the PendingUpdate that raises the go directive in go.mod instead of updating a dependency
+const goDirective = "go"
+
+// goDirectiveUpdate returns the update of the go directive in the go.mod at path to goVersion, if it's lower than that.
+// The go directive is never lowered.
+func (r *runner) goDirectiveUpdate(path, goVersion string) (PendingUpdate, bool) {
+	if goVersion == "" {
+		return PendingUpdate{}, false
+	}
+
+	file, err := r.readGoMod(path)
+	if err != nil {
+		return PendingUpdate{}, false
+	}
+
+	currentVersion := file.Go
+
+	if upgrade, _ := upgradeDecision("v"+currentVersion, "v"+goVersion, false, false, nil); currentVersion != "" && !upgrade {
+		return PendingUpdate{}, false
+	}
+	return PendingUpdate{Module: goDirective, CurrentVersion: currentVersion, TargetVersion: goVersion}, true
+}
+
+// replaceUpdates returns the replace directives to add to the go.mod at path, for every required module that has a
+// replacement and isn't already replaced by it
+func (r *runner) replaceUpdates(path string, replacements []Replacement) []PendingUpdate {
+	var updates []PendingUpdate
+	for _, replacement := range replacements {
+		for _, required := range r.getDependencyVersions(path, replacement.Old) {
+			if current, ok := r.getReplacement(path, required.Path, required.Version); ok && current.Path == replacement.New && current.Version == replacement.Version {
+				continue
+			}
+
+			updates = append(updates, PendingUpdate{
+				Module:         required.Path,
+				CurrentVersion: required.Version,
+				TargetVersion:  replacement.Version,
+				Replacement:    replacement.New,
+			})
+		}
+	}
+	return updates
+}
+
+// usesAnyReplacement reports whether the go.mod at path requires at least one of the modules to replace
+func (r *runner) usesAnyReplacement(path string, replacements []Replacement) bool {
+	for _, replacement := range replacements {
+		if len(r.getDependencyVersions(path, replacement.Old)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// toolUpdates keeps the updates of modules with tools in the tool directives of the go.mod at path, and sets their
+// Tools. Each tool is the module's that is the longest prefix of its package path among the required modules.
+func (r *runner) toolUpdates(path string, updates []PendingUpdate) []PendingUpdate {
+	file, err := r.readGoMod(path)
+	if err != nil {
+		return nil
+	}
+
+	var tools []PendingUpdate
+	for _, update := range updates {
+		update.Tools = nil
+		for _, tool := range file.Tools {
+			if owner, ok := owningModule(tool, file.Requires); ok && owner == update.Module {
+				update.Tools = append(update.Tools, tool)
+			}
+		}
+		if len(update.Tools) == 0 {
+			r.logger.Debugf("Not updating %s in %s, it has no tool directive for it (--tool)", update.Module, path)
+			continue
+		}
+		tools = append(tools, update)
+	}
+	return tools
+}
+
+// owningModule returns the path of the module among requires that provides the package. That's the longest one the
+// package path is in, since a module can be nested in the path of another one.
+func owningModule(pkg string, requires []module.Version) (string, bool) {
+	owner := ""
+	for _, require := range requires {
+		if (pkg == require.Path || strings.HasPrefix(pkg, require.Path+"/")) && len(require.Path) > len(owner) {
+			owner = require.Path
+		}
+	}
+	return owner, owner != ""
+}
+
+// excludeUpdates returns the exclude directives to add to the go.mod at path, for every version to exclude of a
+// module it requires that isn't already excluded
+func (r *runner) excludeUpdates(path string, exclusions []DependencyUpdate) []PendingUpdate {
+	if len(exclusions) == 0 {
+		return nil
+	}
+
+	file, err := r.readGoMod(path)
+	if err != nil {
+		return nil
+	}
+
+	var updates []PendingUpdate
+	for _, exclusion := range exclusions {
+		for _, required := range r.getDependencyVersions(path, exclusion.Module) {
+			if isExcluded(file.Excludes, required.Path, exclusion.Version) {
+				continue
+			}
+
+			updates = append(updates, PendingUpdate{
+				Module:         required.Path,
+				CurrentVersion: required.Version,
+				TargetVersion:  exclusion.Version,
+				Exclude:        true,
+			})
+		}
+	}
+	return updates
+}
+
+// isExcluded reports whether the go.mod has an exclude directive for the module at version
+func isExcluded(excludes []module.Version, modulePath, version string) bool {
+	for _, exclude := range excludes {
+		if exclude.Path == modulePath && exclude.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// usesAnyExclusion reports whether the go.mod at path requires at least one of the modules to exclude a version of
+func (r *runner) usesAnyExclusion(path string, exclusions []DependencyUpdate) bool {
+	for _, exclusion := range exclusions {
+		if len(r.getDependencyVersions(path, exclusion.Module)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// upgradeDecision decides whether currentVersion should be changed to targetVersion, and why not when there's a
+// reason to tell. A version that doesn't satisfy onlyIfCurrent is never changed, and the same version only with
+// force. Unless allowDowngrade is set, it's otherwise only changed when targetVersion is a newer semantic version.
+// Pre-releases and pseudo-versions are ordered by semver rules. Versions that aren't valid semver (e.g. branch names)
+// can't be ordered and fall back to a plain inequality check. Versions of the same commit never need changing, see
+// sameRevision.
+func upgradeDecision(currentVersion, targetVersion string, allowDowngrade, force bool, onlyIfCurrent VersionConstraint) (upgrade bool, reason string) {
+	if !onlyIfCurrent.allows(currentVersion) {
+		return false, fmt.Sprintf("its version %s doesn't satisfy --only-if-current %s", currentVersion, onlyIfCurrent)
+	}
+
+	if currentVersion == targetVersion {
+		return force, ""
+	}
+
+	if sameRevision(currentVersion, targetVersion) {
+		return false, fmt.Sprintf("%s and %s are the same commit", currentVersion, targetVersion)
+	}
+
+	if !semver.IsValid(currentVersion) || !semver.IsValid(targetVersion) {
+		return true, ""
+	}
+
+	cmp := semver.Compare(targetVersion, currentVersion)
+	if cmp < 0 && !allowDowngrade {
+		return false, fmt.Sprintf("not downgrading from %s to %s, use --allow-downgrade to do so", currentVersion, targetVersion)
+	}
+	return cmp != 0, ""
+}
+
+// sameRevision reports whether the versions are the same commit: two pseudo-versions of the same revision, which
+// differ when they're based on different tags, or a pseudo-version and a commit hash it starts with or that starts
+// with its revision, like go get <module>@<hash> accepts. Tags can't be matched to commits without fetching them.
+func sameRevision(currentVersion, targetVersion string) bool {
+	currentRev, err := module.PseudoVersionRev(currentVersion)
+	if err != nil {
+		return false
+	}
+
+	if module.IsPseudoVersion(targetVersion) {
+		targetRev, err := module.PseudoVersionRev(targetVersion)
+		return err == nil && targetRev == currentRev
+	}
+
+	if len(targetVersion) < 7 || !isHex(targetVersion) {
+		return false
+	}
+	return strings.HasPrefix(targetVersion, currentRev) || strings.HasPrefix(currentRev, targetVersion)
+}
+
+// isHex reports whether s consists of lowercase hexadecimal digits, like a git commit hash
+func isHex(s string) bool {
+	for _, r := range s {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func describeUpdates(updates []PendingUpdate) string {
+	descriptions := make([]string, 0, len(updates))
+	for _, update := range updates {
+		if update.Replacement != "" {
+			descriptions = append(descriptions, fmt.Sprintf("%s %s replaced by %s %s", update.Module, update.CurrentVersion, update.Replacement, update.TargetVersion))
+			continue
+		}
+		if update.Exclude {
+			descriptions = append(descriptions, fmt.Sprintf("%s %s excluded (requires %s)", update.Module, update.TargetVersion, update.CurrentVersion))
+			continue
+		}
+		descriptions = append(descriptions, fmt.Sprintf("%s from version %s to %s", update.Module, update.CurrentVersion, update.TargetVersion))
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+// isGitRepo reports whether projectDir is inside a git working tree
+func (r *runner) isGitRepo(projectDir string) bool {
+	out, err := r.executeCommand(localCommand, projectDir, "git", "rev-parse", "--is-inside-work-tree")
+	return err == nil && strings.TrimSpace(out) == "true"
+}
+
+// gitOperationMarkers are left in the git directory while a merge, rebase, cherry-pick, revert or bisect is in progress
+var gitOperationMarkers = []string{"MERGE_HEAD", "rebase-merge", "rebase-apply", "CHERRY_PICK_HEAD", "REVERT_HEAD", "BISECT_LOG"}
+
+// isGitOperationInProgress reports whether the git repository in projectDir is in the middle of a merge, rebase or
+// similar operation that has to be finished or aborted before it's safe to run other git commands
+func (r *runner) isGitOperationInProgress(projectDir string) bool {
+	out, err := r.executeCommand(localCommand, projectDir, "git", "rev-parse", "--absolute-git-dir")
+	if err != nil {
+		return false
+	}
+
+	gitDir := strings.TrimSpace(out)
+	for _, marker := range gitOperationMarkers {
+		if directoryHasFile(gitDir, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasRemote reports whether the git repository in projectDir has a remote with the given name
+func (r *runner) hasRemote(projectDir, name string) bool {
+	out, err := r.executeCommand(localCommand, projectDir, "git", "remote")
+	if err != nil {
+		return false
+	}
+
+	for _, remote := range strings.Fields(out) {
+		if remote == name {
+			return true
+		}
+	}
+	return false
+}
+
+// gitLastCommitTime returns when the commit HEAD points to was made
+func (r *runner) gitLastCommitTime(projectDir string) (time.Time, error) {
+	out, err := r.executeCommand(localCommand, projectDir, "git", "log", "-1", "--format=%ct")
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	seconds, err := strconv.ParseInt(strings.TrimSpace(out), 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unexpected output from git log: %q", out)
+	}
+	return time.Unix(seconds, 0), nil
+}
+
+func (r *runner) hasUncommittedChanges(projectDir string) bool {
+	out, _ := r.executeCommand(localCommand, projectDir, "git", "status", "--porcelain")
+	return len(out) > 0
+}
+
+// wipCommitMessage is the message of the commit --commit-wip makes of uncommitted changes
+const wipCommitMessage = "WIP: uncommitted changes committed by go-dep-updater before updating dependencies"
+
+// hasUntrackedFiles reports whether the repository has untracked files that aren't ignored
+func (r *runner) hasUntrackedFiles(projectDir string) bool {
+	out, _ := r.executeCommand(localCommand, projectDir, "git", "ls-files", "--others", "--exclude-standard", "--", ":/")
+	return len(out) > 0
+}
+
+// gitCommitWIP commits the uncommitted changes to tracked files in the repository as a WIP commit. Untracked files
+// aren't committed, projects that have them are skipped before.
+func (r *runner) gitCommitWIP(projectDir string, flags []string) error {
+	if _, err := r.executeCommand(localCommand, projectDir, "git", "add", "-u", ":/"); err != nil {
+		return err
+	}
+	_, err := r.executeCommand(localCommand, projectDir, "git", append([]string{"commit", "-m", wipCommitMessage}, flags...)...)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *runner) gitStash(projectDir string) error {
+	_, err := r.executeCommand(localCommand, projectDir, "git", "stash", "push", "--include-untracked", "-m", "go-dep-updater: stashed before updating dependencies")
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *runner) gitStashPop(projectDir string) error {
+	_, err := r.executeCommand(cleanupCommand, projectDir, "git", "stash", "pop")
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// gitPull brings the current branch up to date with branch on remote, using the --pull-strategy:
+// merging it (a plain git pull), rebasing onto it, or hard-resetting to it
+func (r *runner) gitPull(projectDir, remote, branch, strategy string) error {
+	switch strategy {
+	case PullStrategyRebase:
+		return r.retryTransient("git pull", func() error {
+			_, err := r.executeCommand(networkCommand, projectDir, "git", "pull", "--rebase", remote, branch)
+			return err
+		})
+	case PullStrategyReset:
+		err := r.retryTransient("git fetch", func() error {
+			_, err := r.executeCommand(networkCommand, projectDir, "git", "fetch", remote, branch)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		// The working tree was checked to be clean before, but a reset would silently discard whatever isn't committed
+		if r.hasUncommittedChanges(projectDir) {
+			return fmt.Errorf("refusing to reset to %s/%s, there are uncommitted changes", remote, branch)
+		}
+		_, err = r.executeCommand(localCommand, projectDir, "git", "reset", "--hard", remote+"/"+branch)
+		return err
+	default:
+		return r.retryTransient("git pull", func() error {
+			_, err := r.executeCommand(networkCommand, projectDir, "git", "pull", remote, branch)
+			return err
+		})
+	}
+}
+
+// GoGetUpdate updates the dependencies to their target versions with go get and the given flags (see goGetFlags),
+// adds the replace and exclude directives of replacement and exclude updates, and with tidy set, tidies go.mod and
+// go.sum with go mod tidy and the given tidy flags (see goModTidyFlags).
+func GoGetUpdate(projectDir string, updates []PendingUpdate, flags []string, tidy bool, tidyFlags []string, env []string) error {
+	return defaultRunner().goGetUpdate(projectDir, updates, flags, tidy, tidyFlags, env)
+}
+
+// goGetUpdate is GoGetUpdate within a run
+func (r *runner) goGetUpdate(projectDir string, updates []PendingUpdate, flags []string, tidy bool, tidyFlags []string, env []string) error {
+	for _, update := range updates {
+		if update.Module != goDirective {
+			continue
+		}
+
+		_, err := r.executeCommandWithEnv(localCommand, projectDir, env, r.goBinary, "mod", "edit", "-go="+update.TargetVersion)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, update := range updates {
+		if update.Replacement == "" {
+			continue
+		}
+
+		_, err := r.executeCommandWithEnv(localCommand, projectDir, env, r.goBinary, "mod", "edit", "-replace="+update.replaceArg())
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, update := range updates {
+		if !update.Exclude {
+			continue
+		}
+
+		_, err := r.executeCommandWithEnv(localCommand, projectDir, env, r.goBinary, "mod", "edit", "-exclude="+update.Module+"@"+update.TargetVersion)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, arg := range goGetArgs(updates) {
+		args := append(append([]string{"get"}, flags...), arg)
+		out, err := r.executeCommandWithEnv(networkCommand, projectDir, env, r.goBinary, args...)
+		if err != nil {
+			return wrapToolchainError(projectDir, wrapModuleFetchError(err, out), out)
+		}
+	}
+
+	if !tidy {
+		return nil
+	}
+
+	out, err := r.executeCommandWithEnv(networkCommand, projectDir, env, r.goBinary, append([]string{"mod", "tidy"}, tidyFlags...)...)
+	if err != nil {
+		return wrapToolchainError(projectDir, wrapModuleFetchError(err, out), out)
+	}
+	return nil
+}
+
+// toolchainErrorRE matches the go command refusing a module that needs a newer Go version, e.g.
+// "go: example.com/foo@v1.2.3 requires go >= 1.22.0 (running go 1.21.5; GOTOOLCHAIN=local)"
+var toolchainErrorRE = regexp.MustCompile(`(\S+@\S+) requires go >= ([0-9][^\s;)]*)(?: \(running go ([0-9][^\s;)]*))?`)
+
+// wrapToolchainError explains the error of a go command that failed because a module requires a newer Go version
+// than the project in projectDir declares, or than the installed toolchain, and what to do about it
+func wrapToolchainError(projectDir string, err error, out string) error {
+	match := toolchainErrorRE.FindStringSubmatch(out)
+	if match == nil {
+		return err
+	}
+	module, required, running := match[1], match[2], match[3]
+
+	declared := ""
+	if file, parseErr := parseGoMod(filepath.Join(projectDir, "go.mod")); parseErr == nil && file.Go != nil {
+		declared = file.Go.Version
+	}
+
+	if declared != "" && semver.Compare("v"+declared, "v"+required) < 0 {
+		return fmt.Errorf("%s requires go >= %s but the project declares go %s, use --go-version %s to raise it along with the update: %w", module, required, declared, required, err)
+	}
+	if running != "" {
+		return fmt.Errorf("%s requires go >= %s but go %s is installed, install a newer Go toolchain or allow downloading one with GOTOOLCHAIN=auto: %w", module, required, running, err)
+	}
+	return fmt.Errorf("%s requires go >= %s: %w", module, required, err)
+}
+
+// goGetFlags returns the go get flags for --update-indirect, which also updates the dependencies of the updated
+// modules to their latest minor or patch versions (-u), --include-test-deps, which also considers the
+// dependencies of tests (-t), and --tool, which updates tools (-tool). go mod tidy keeps the dependencies of the
+// module's own tests either way.
+func goGetFlags(opts *Options) []string {
+	var flags []string
+	if opts.Tool {
+		flags = append(flags, "-tool")
+	}
+	if opts.UpdateIndirect {
+		flags = append(flags, "-u")
+	}
+	if opts.IncludeTestDeps {
+		flags = append(flags, "-t")
+	}
+	return flags
+}
+
+// goModTidyFlags returns the go mod tidy flags for --tidy-compat, the Go version whose go command go.sum must stay
+// compatible with (-compat). It decides which checksums tidy keeps for modules that version would still load.
+func goModTidyFlags(opts *Options) []string {
+	if opts.TidyCompat == "" {
+		return nil
+	}
+	return []string{"-compat=" + opts.TidyCompat}
+}
+
+// goCommandEnv returns the environment variables to add to the go commands: GOPRIVATE from --goprivate, then the
+// ones given with --env, so those win. They take precedence over the same variables in the current environment,
+// which is otherwise inherited as is.
+func goCommandEnv(opts *Options) []string {
+	var env []string
+	if opts.GoPrivate != "" {
+		env = append(env, "GOPRIVATE="+opts.GoPrivate)
+	}
+	return append(env, opts.Env...)
+}
+
+// projectGoEnv returns the environment of the go commands that update and check the project. go get and go mod
+// tidy inside a workspace resolve versions across all of its modules, which can leave this module's go.mod and go.sum
+// inconsistent on their own. It's updated as a standalone module instead (GOWORK=off), since that's what gets
+// committed, and checked the same way, so the checks build what's committed. Run go work sync afterwards to bring
+// the rest of the workspace in line.
+func projectGoEnv(opts *Options, projectDir string) []string {
+	env := goCommandEnv(opts)
+	if _, ok := findWorkspaceRoot(projectDir); ok {
+		env = append(env, "GOWORK=off")
+	}
+	return env
+}
+
+// authErrorPatterns are found in the output of go commands that failed to authenticate against a module's origin or proxy
+var authErrorPatterns = []string{
+	"terminal prompts disabled",
+	"could not read Username",
+	"Authentication failed",
+	"Permission denied (publickey)",
+	"401 Unauthorized",
+	"403 Forbidden",
+	"410 Gone",
+}
+
+// wrapModuleFetchError returns the error of a go command that fetches modules,
+// calling out authentication failures so they stand out from other failures.
+func wrapModuleFetchError(err error, out string) error {
+	for _, pattern := range authErrorPatterns {
+		if strings.Contains(out, pattern) {
+			return fmt.Errorf("authentication failed, check that private modules are listed in --goprivate or GOPRIVATE and that git has credentials for them: %w", err)
+		}
+	}
+	return err
+}
+
+// isWorkspaceRoot reports whether dir contains a go.work file
+func isWorkspaceRoot(dir string) bool {
+	return directoryHasFile(dir, "go.work")
+}
+
+// findWorkspaceRoot returns the closest directory at or above projectDir that contains a go.work file,
+// which is the workspace the go command would use for the project.
+func findWorkspaceRoot(projectDir string) (string, bool) {
+	dir, err := filepath.Abs(projectDir)
+	if err != nil {
+		return "", false
+	}
+
+	for {
+		if isWorkspaceRoot(dir) {
+			return dir, true
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// goGetArgs returns the <module>@<version> arguments for go get, or <tool>@<version> for every tool of the
+// updates made with go get -tool
+func goGetArgs(updates []PendingUpdate) []string {
+	args := make([]string, 0, len(updates))
+	for _, update := range updates {
+		if update.Module == goDirective || update.Replacement != "" || update.Exclude {
+			continue
+		}
+		if len(update.Tools) > 0 {
+			for _, tool := range update.Tools {
+				args = append(args, fmt.Sprintf("%s@%s", tool, update.TargetVersion))
+			}
+			continue
+		}
+		args = append(args, fmt.Sprintf("%s@%s", update.Module, update.TargetVersion))
+	}
+	return args
+}
+
+// resolveLatestVersions replaces the VersionLatest keyword with the concrete latest version of each dependency,
+// so the same version is used everywhere downstream.
+func (r *runner) resolveLatestVersions(opts *Options) error {
+	for i, dependency := range opts.Dependencies {
+		if dependency.Version != VersionLatest {
+			continue
+		}
+
+		version, err := r.latestVersion(opts, dependency.Module)
+		if err != nil {
+			return fmt.Errorf("error resolving latest version of %s: %v", dependency.Module, err)
+		}
+
+		r.logger.Infof("Resolved latest version of %s to %s", dependency.Module, version)
+		opts.Dependencies[i].Version = version
+	}
+	return nil
+}
+
+// latestVersion returns the highest semantic version of the module known to the module proxy,
+// leaving out pre-releases unless allowed and the versions given with --skip-version
+func (r *runner) latestVersion(opts *Options, dependency string) (string, error) {
+	out, err := r.executeCommandWithEnv(networkCommand, "", goCommandEnv(opts), r.goBinary, "list", "-m", "-versions", dependency)
+	if err != nil {
+		return "", wrapModuleFetchError(err, out)
+	}
+
+	// Output is the module path followed by its versions: <module> v1.0.0 v1.1.0 ...
+	fields := strings.Fields(out)
+	if len(fields) < 2 {
+		return "", fmt.Errorf("no versions found")
+	}
+
+	var versions []string
+	for _, version := range fields[1:] {
+		if !semver.IsValid(version) {
+			continue
+		}
+		if semver.Prerelease(version) != "" && !opts.AllowPrerelease {
+			continue
+		}
+		if opts.skipsVersion(dependency, version) {
+			r.logger.Infof("Skipping %s@%s, given with --skip-version", dependency, version)
+			continue
+		}
+		versions = append(versions, version)
+	}
+
+	if len(versions) == 0 {
+		return "", fmt.Errorf("no tagged versions found")
+	}
+
+	semver.Sort(versions)
+	return versions[len(versions)-1], nil
+}
+
+// runPreCommitCommand runs a user supplied shell command in the project directory and returns its output
+func (r *runner) runPreCommitCommand(projectDir, command string) (string, error) {
+	return r.executeCommand(buildCommand, projectDir, "sh", "-c", command)
+}
+
+// runVerifyCommand runs the user supplied shell command that validates an update in the project directory, with
+// the environment of the go commands. Like go test, it's limited by the test timeout.
+func (r *runner) runVerifyCommand(projectDir, command string, env []string) error {
+	_, err := r.executeCommandWithEnv(testCommand, projectDir, env, "sh", "-c", command)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// goModVerify checks that the dependencies in the module cache haven't been modified since they were downloaded
+func (r *runner) goModVerify(projectDir string, env []string) (string, error) {
+	return r.executeCommandWithEnv(networkCommand, projectDir, env, r.goBinary, "mod", "verify")
+}
+
+func (r *runner) goVet(projectDir string, vetArgs, env []string) error {
+	_, err := r.executeCommandWithEnv(buildCommand, projectDir, env, r.goBinary, goCheckArgs("vet", vetArgs)...)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *runner) goTest(projectDir string, testArgs, env []string) error {
+	_, err := r.executeCommandWithEnv(testCommand, projectDir, env, r.goBinary, goCheckArgs("test", testArgs)...)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// goCheckArgs returns the arguments for go vet or go test with the extra arguments given by the user.
+// They run on all packages (./...) unless the extra arguments name packages themselves, as relative paths.
+func goCheckArgs(command string, extraArgs []string) []string {
+	args := append([]string{command}, extraArgs...)
+	for _, arg := range extraArgs {
+		if strings.HasPrefix(arg, ".") {
+			return args
+		}
+	}
+	return append(args, "./...")
+}
+
+// goBuild compiles every package in the project, whatever its layout. Binaries of main packages are discarded.
+func (r *runner) goBuild(projectDir string, env []string) error {
+	_, err := r.executeCommandWithEnv(buildCommand, projectDir, env, r.goBinary, "build", "-o", os.DevNull, "./...")
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// getDependencyVersion returns the version the go.mod at filePath requires of the exact module path dependency.
+// It returns VersionNotFound if the module isn't required, and VersionUnknown if go.mod can't be read or parsed.
+func (r *runner) getDependencyVersion(filePath, dependency string) string {
+	requires, err := r.readRequires(filePath)
+	if err != nil {
+		r.logger.Debugf("Failed to parse %s: %v", filePath, err)
+		return VersionUnknown
+	}
+
+	for _, require := range requires {
+		if require.Path == dependency {
+			return require.Version
+		}
+	}
+
+	return VersionNotFound
+}
+
+// getDependencyVersions returns every module required by the go.mod at filePath that matches dependency,
+// which can be an exact module path or a pattern (see matchesDependency).
+func (r *runner) getDependencyVersions(filePath, dependency string) []module.Version {
+	requires, err := r.readRequires(filePath)
+	if err != nil {
+		r.logger.Debugf("Failed to parse %s: %v", filePath, err)
+		return nil
+	}
+	return requiresMatching(requires, dependency)
+}
+
+// requiresMatching returns the required module versions that match dependency, which can be an exact module path
+// or a pattern (see matchesDependency)
+func requiresMatching(requires []module.Version, dependency string) []module.Version {
+	var matches []module.Version
+	for _, require := range requires {
+		if matchesDependency(dependency, require.Path) {
+			matches = append(matches, require)
+		}
+	}
+	return matches
+}
+
+// getReplacement returns what a replace directive in the go.mod at filePath replaces the dependency at version with
+func (r *runner) getReplacement(filePath, dependency, version string) (module.Version, bool) {
+	file, err := r.readGoMod(filePath)
+	if err != nil {
+		return module.Version{}, false
+	}
+
+	for _, replace := range file.Replaces {
+		if replace.Old.Path == dependency && (replace.Old.Version == "" || replace.Old.Version == version) {
+			return replace.New, true
+		}
+	}
+	return module.Version{}, false
+}
+
+// formatModuleVersion formats a replacement as it's written in go.mod: a local path, or a module path and version
+func formatModuleVersion(mod module.Version) string {
+	if mod.Version == "" {
+		return mod.Path
+	}
+	return mod.Path + " " + mod.Version
+}
+
+func parseGoMod(filePath string) (*modfile.File, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return modfile.Parse(filePath, data, nil)
+}
+
+// moduleName returns the module path declared by the go.mod at goModPath. It identifies the project, while the
+// directory name the project is known by in logs and the summary can be anything.
+func (r *runner) moduleName(goModPath string) (string, error) {
+	file, err := r.readGoMod(goModPath)
+	if err != nil {
+		return "", err
+	}
+	if file.Module == "" {
+		return "", fmt.Errorf("%s has no module directive", goModPath)
+	}
+	return file.Module, nil
+}
+
+// isDependencyPattern reports whether dependency matches several modules, like github.com/myorg/* or github.com/myorg/...
+func isDependencyPattern(dependency string) bool {
+	return strings.HasSuffix(dependency, "/...") || strings.ContainsAny(dependency, "*?[")
+}
+
+// matchesDependency reports whether modulePath matches dependency. A dependency ending in /* or /... matches every
+// module under that prefix, other patterns are matched with path.Match and anything else must be an exact match.
+func matchesDependency(dependency, modulePath string) bool {
+	if !isDependencyPattern(dependency) {
+		return dependency == modulePath
+	}
+
+	for _, suffix := range []string{"/...", "/*"} {
+		if prefix, ok := strings.CutSuffix(dependency, suffix); ok && !isDependencyPattern(prefix) {
+			return strings.HasPrefix(modulePath, prefix+"/")
+		}
+	}
+
+	matched, _ := path.Match(dependency, modulePath)
+	return matched
+}
+
+// gitFileStates returns the git status of every changed or untracked file in projectDir along with the hash of its
+// content, by its path from the top of the repository, so changes to files that were already changed can be told too
+func (r *runner) gitFileStates(projectDir string) (map[string]string, error) {
+	top, err := r.executeCommand(localCommand, projectDir, "git", "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	out, err := r.executeCommand(localCommand, projectDir, "git", "status", "--porcelain", "-z", "--untracked-files=all", "--", ".")
+	if err != nil {
+		return nil, err
+	}
+
+	states := map[string]string{}
+	entries := strings.Split(out, "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 4 {
+			continue
+		}
+		status, path := entry[:2], entry[3:]
+		// A rename or copy is followed by the path it's from
+		if status[0] == 'R' || status[0] == 'C' {
+			i++
+		}
+
+		state := status
+		if data, err := os.ReadFile(filepath.Join(strings.TrimSpace(top), path)); err == nil {
+			sum := sha256.Sum256(data)
+			state += " " + hex.EncodeToString(sum[:])
+		}
+		states[path] = state
+	}
+	return states, nil
+}
+
+// changedFiles returns the files whose state changed from before to after, leaving out files that were untracked before
+func changedFiles(before, after map[string]string) []string {
+	var files []string
+	for path, state := range after {
+		if previous, ok := before[path]; !ok || (previous != state && !strings.HasPrefix(previous, "??")) {
+			files = append(files, path)
+		}
+	}
+	for path, state := range before {
+		if _, ok := after[path]; !ok && !strings.HasPrefix(state, "??") {
+			files = append(files, path)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// gitAddFiles stages the files, given by their path from the top of the repository
+func (r *runner) gitAddFiles(projectDir string, files []string) error {
+	if len(files) == 0 {
+		return nil
+	}
+	args := []string{"add", "-A", "--"}
+	for _, file := range files {
+		args = append(args, ":(top,literal)"+file)
+	}
+	_, err := r.executeCommand(localCommand, projectDir, "git", args...)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// rollbackDependencyFiles restores go.mod and go.sum to their committed state, leaving any other changes alone.
+// A go.sum that isn't committed yet was created by the update and is removed.
+func (r *runner) rollbackDependencyFiles(projectDir string) error {
+	for _, file := range []string{"go.mod", "go.sum"} {
+		if _, err := r.executeCommand(cleanupCommand, projectDir, "git", "cat-file", "-e", "HEAD:"+file); err != nil {
+			if err := os.Remove(filepath.Join(projectDir, file)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+
+		_, err := r.executeCommand(cleanupCommand, projectDir, "git", "checkout", "HEAD", "--", file)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gitDiffDependencyFiles returns the changes to go.mod and go.sum since the last commit, staged or not
+func (r *runner) gitDiffDependencyFiles(projectDir string) (string, error) {
+	out, err := r.executeCommand(localCommand, projectDir, "git", "diff", "HEAD", "--", "go.mod", "go.sum")
+	if err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// gitDependencyFilesChanged reports whether go.mod or go.sum has uncommitted changes, including a new go.sum
+func (r *runner) gitDependencyFilesChanged(projectDir string) (bool, error) {
+	out, err := r.executeCommand(localCommand, projectDir, "git", "status", "--porcelain", "--", "go.mod", "go.sum")
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(out) != "", nil
+}
+
+// gitShowLastCommits returns the messages and changes of the last count commits
+func (r *runner) gitShowLastCommits(projectDir string, count int) (string, error) {
+	return r.executeCommand(localCommand, projectDir, "git", "log", "--stat", "--patch", "-n", strconv.Itoa(count))
+}
+
+// printDiff prints a unified diff with added lines in green and removed lines in red
+func (r *runner) printDiff(diff string) {
+	for _, line := range strings.Split(strings.TrimRight(diff, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			fmt.Println(line)
+		case strings.HasPrefix(line, "+"):
+			fmt.Println(r.colorize(chalk.Green, line))
+		case strings.HasPrefix(line, "-"):
+			fmt.Println(r.colorize(chalk.Red, line))
+		case strings.HasPrefix(line, "@@"):
+			fmt.Println(r.colorize(chalk.Cyan, line))
+		default:
+			fmt.Println(line)
+		}
+	}
+}
+
+// GitCommit commits the changes to go.mod and go.sum of every project dir in the repository at repoDir. A module
+// without dependencies may not have a go.sum, so it's only staged when it exists now or did in the last commit
+// (in which case its removal is committed).
+func GitCommit(repoDir string, projectDirs []string, commitMessage string, flags []string) error {
+	return defaultRunner().gitCommit(repoDir, projectDirs, commitMessage, flags)
+}
+
+// gitCommit is GitCommit within a run
+func (r *runner) gitCommit(repoDir string, projectDirs []string, commitMessage string, flags []string) error {
+	for _, projectDir := range projectDirs {
+		files := []string{"go.mod"}
+		if _, err := r.executeCommand(localCommand, projectDir, "git", "cat-file", "-e", "HEAD:./go.sum"); err == nil || directoryHasFile(projectDir, "go.sum") {
+			files = append(files, "go.sum")
+		}
+
+		_, err := r.executeCommand(localCommand, projectDir, "git", append([]string{"add", "-A", "--"}, files...)...)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := r.executeCommand(localCommand, repoDir, "git", append([]string{"commit", "-m", commitMessage}, flags...)...)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// gitCommitProject commits the changes to go.mod and go.sum of the project in projectDir, and whatever else is staged
+// in it, but nothing outside of it or in the other projects of the repository, given by the paths of their go.mod.
+// Changes staged in other projects, including ones nested in projectDir, are left for their own commits.
+func (r *runner) gitCommitProject(repoDir, projectDir string, goModPaths []string, commitMessage string, flags []string) error {
+	// The pathspecs are resolved from repoDir, while the directories may be relative to the working directory
+	absDir, err := filepath.Abs(projectDir)
+	if err != nil {
+		return err
+	}
+
+	pathspecs := []string{absDir}
+	for _, goModPath := range goModPaths {
+		otherDir, err := filepath.Abs(filepath.Dir(goModPath))
+		if err != nil {
+			return err
+		}
+		if otherDir != absDir && strings.HasPrefix(otherDir, absDir+string(filepath.Separator)) {
+			pathspecs = append(pathspecs, ":(exclude)"+otherDir)
+		}
+	}
+	return r.gitCommit(repoDir, []string{projectDir}, commitMessage, append(append(append([]string{}, flags...), "--"), pathspecs...))
+}
+
+// commitFlags returns the extra git commit flags for amending, --signoff and --trailer
+func commitFlags(opts *Options, amend bool) []string {
+	var flags []string
+	if amend {
+		flags = append(flags, "--amend")
+	}
+	if opts.Signoff {
+		flags = append(flags, "--signoff")
+	}
+	for _, trailer := range opts.Trailers {
+		flags = append(flags, "--trailer", trailer)
+	}
+	return flags
+}
+
+// commitTrailer marks the commits made by go-dep-updater with --amend, so the next run with --amend can tell them
+// apart from other commits
+const commitTrailer = "Updated-by: go-dep-updater"
+
+// trailerRE matches a git trailer line, like "Signed-off-by: Jane Doe <jane@example.com>"
+var trailerRE = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]*: `)
+
+func withCommitTrailer(message string) string {
+	return strings.TrimRight(message, "\n") + "\n\n" + commitTrailer
+}
+
+// isDepUpdateCommit reports whether the commit message has the commitTrailer among its trailers
+func isDepUpdateCommit(message string) bool {
+	_, trailers := splitTrailers(message)
+	for _, trailer := range trailers {
+		if trailer == commitTrailer {
+			return true
+		}
+	}
+	return false
+}
+
+// splitTrailers splits the commit message into its body and its trailers, which are the lines of the last paragraph
+// if every one of them is a trailer like git interpret-trailers recognizes. A message with a single paragraph has no
+// trailers, the subject is never one.
+func splitTrailers(message string) (body string, trailers []string) {
+	message = strings.TrimSpace(message)
+	i := strings.LastIndex(message, "\n\n")
+	if i < 0 {
+		return message, nil
+	}
+
+	for _, line := range strings.Split(message[i+2:], "\n") {
+		if line = strings.TrimRight(line, " \t"); !trailerRE.MatchString(line) {
+			return message, nil
+		}
+		trailers = append(trailers, line)
+	}
+	return strings.TrimSpace(message[:i]), trailers
+}
+
+// gitHeadMessage returns the full message of the commit HEAD points to
+func (r *runner) gitHeadMessage(projectDir string) (string, error) {
+	out, err := r.executeCommand(localCommand, projectDir, "git", "log", "-1", "--format=%B")
+	if err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// gitHeadIsPushed reports whether the commit HEAD points to is on any remote-tracking branch.
+// Amending it would then need a force push.
+func (r *runner) gitHeadIsPushed(projectDir string) bool {
+	out, err := r.executeCommand(localCommand, projectDir, "git", "branch", "-r", "--contains", "HEAD")
+	return err != nil || strings.TrimSpace(out) != ""
+}
+
+// commitMessageData is what a --commit-message template is rendered with. Dependency, OldVersion and NewVersion
+// refer to the first update, use Updates to list all of them when several dependencies are updated.
+type commitMessageData struct {
+	Project    string
+	Module     string
+	Dependency string
+	OldVersion string
+	NewVersion string
+	Updates    []PendingUpdate
+}
+
+// formatCommitMessage renders the commit message template, or the default message if the template is empty
+func formatCommitMessage(commitTemplate, projectName string, modules []string, updates []PendingUpdate) (string, error) {
+	if commitTemplate == "" {
+		return defaultCommitMessage(updates), nil
+	}
+
+	tmpl, err := template.New("commit-message").Parse(commitTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	data := commitMessageData{
+		Project:    projectName,
+		Module:     strings.Join(modules, ", "),
+		Dependency: updates[0].Module,
+		OldVersion: updates[0].CurrentVersion,
+		NewVersion: updates[0].TargetVersion,
+		Updates:    updates,
+	}
+
+	var message strings.Builder
+	if err := tmpl.Execute(&message, data); err != nil {
+		return "", err
+	}
+	return message.String(), nil
+}
+
+func defaultCommitMessage(updates []PendingUpdate) string {
+	if len(updates) == 1 && updates[0].Replacement != "" {
+		return fmt.Sprintf("Replaced %s with %s %s", updates[0].Module, updates[0].Replacement, updates[0].TargetVersion)
+	}
+	if len(updates) == 1 && updates[0].Exclude {
+		return fmt.Sprintf("Excluded %s %s", updates[0].Module, updates[0].TargetVersion)
+	}
+	if len(updates) == 1 {
+		return fmt.Sprintf("Updated %s to version %s", updates[0].Module, updates[0].TargetVersion)
+	}
+
+	lines := []string{fmt.Sprintf("Updated %d dependencies", len(updates)), ""}
+	for _, update := range updates {
+		if update.Replacement != "" {
+			lines = append(lines, fmt.Sprintf("- %s replaced with %s %s", update.Module, update.Replacement, update.TargetVersion))
+			continue
+		}
+		if update.Exclude {
+			lines = append(lines, fmt.Sprintf("- %s %s excluded", update.Module, update.TargetVersion))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("- %s to version %s", update.Module, update.TargetVersion))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// gitPush pushes branch to remote and sets it as the branch's upstream, which new branches don't have yet
+func (r *runner) gitPush(projectDir, remote, branch string) error {
+	return r.retryTransient("git push", func() error {
+		_, err := r.executeCommand(networkCommand, projectDir, "git", "push", "--set-upstream", remote, branch)
+		if err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// gitCreateBranch creates and switches to branch, starting at startPoint, or HEAD if it's empty. It fails if the
+// branch already exists.
+func (r *runner) gitCreateBranch(projectDir, branch, startPoint string) error {
+	args := []string{"checkout", "-b", branch}
+	if startPoint != "" {
+		args = append(args, startPoint)
+	}
+	_, err := r.executeCommand(localCommand, projectDir, "git", args...)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// abandonFeatureBranch switches back to branch and deletes the --pr branch when there turned out to be nothing to commit
+func (r *runner) abandonFeatureBranch(repoName, repoDir, branch, featureBranch string) {
+	if err := r.gitCheckout(repoDir, branch); err != nil {
+		r.printIndentedWarning(repoName, "Warning: Could not switch back to '%s' branch for project %s: %v", branch, repoName, err)
+	} else if err := r.gitDeleteBranch(repoDir, featureBranch); err != nil {
+		r.printIndentedWarning(repoName, "Warning: Could not delete the branch %s for project %s: %v", featureBranch, repoName, err)
+	}
+}
+
+// resolveBaseRef returns the commit-ish to create the --pr branch from for the --base-ref ref, after fetching the
+// remote's branches and tags. A branch is taken from the remote, where it's up to date, if it's there.
+func (r *runner) resolveBaseRef(projectDir, remote, ref string, remoteConfigured bool) (string, error) {
+	if remoteConfigured {
+		err := r.retryTransient("git fetch", func() error {
+			_, err := r.executeCommand(networkCommand, projectDir, "git", "fetch", "--tags", remote)
+			return err
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	candidates := []string{ref}
+	if remoteConfigured {
+		candidates = []string{remote + "/" + ref, ref}
+	}
+	for _, candidate := range candidates {
+		if _, err := r.executeCommand(localCommand, projectDir, "git", "rev-parse", "--verify", "--quiet", candidate+"^{commit}"); err == nil {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("%s is not a branch, tag or commit", ref)
+}
+
+func (r *runner) gitDeleteBranch(projectDir, branch string) error {
+	_, err := r.executeCommand(localCommand, projectDir, "git", "branch", "-D", branch)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// featureBranchName returns the branch to commit the updates to in --pr mode, e.g. dep-update/github.com/foo/bar-v1.2.3.
+// With --base-ref the base ref is included, e.g. dep-update/release-1.x/github.com/foo/bar-v1.2.3, so backports
+// don't clash with the branch of the same update on the main branch.
+func featureBranchName(updates []PendingUpdate, baseRef string) string {
+	prefix := "dep-update/"
+	if baseRef != "" {
+		prefix += baseRef + "/"
+	}
+	name := fmt.Sprintf("%s%s-%s", prefix, updates[0].Module, updates[0].TargetVersion)
+	if len(updates) > 1 {
+		name += fmt.Sprintf("-and-%d-more", len(updates)-1)
+	}
+	return name
+}
+
+// openPullRequest opens a pull request from branch into baseBranch using the GitHub CLI (gh)
+func (r *runner) openPullRequest(projectDir, baseBranch, branch, title, body string) error {
+	_, err := r.executeCommand(networkCommand, projectDir, "gh", "pr", "create", "--base", baseBranch, "--head", branch, "--title", title, "--body", body)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// openMergeRequest opens a GitLab merge request from branch into baseBranch using the GitLab CLI (glab).
+// A token, if given, is passed to glab instead of the one it's logged in with.
+func (r *runner) openMergeRequest(projectDir, baseBranch, branch, title, body, token string) error {
+	var env []string
+	if token != "" {
+		env = append(env, "GITLAB_TOKEN="+token)
+	}
+
+	_, err := r.executeCommandWithEnv(networkCommand, projectDir, env, "glab", "mr", "create", "--target-branch", baseBranch, "--source-branch", branch, "--title", title, "--description", body, "--yes")
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// pullRequestBody describes the updates of the modules in a pull or merge request, which kind is given by name
+func pullRequestBody(name string, modules []string, updates []PendingUpdate) string {
+	intro := fmt.Sprintf("This %s was created by go-dep-updater.", name)
+	if len(modules) > 0 {
+		intro = fmt.Sprintf("This %s was created by go-dep-updater to update %s.", name, strings.Join(modules, ", "))
+	}
+	lines := []string{intro, "", "| Dependency | From | To |", "|---|---|---|"}
+	for _, update := range updates {
+		lines = append(lines, fmt.Sprintf("| %s | %s | %s |", update.Module, update.CurrentVersion, update.target()))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (r *runner) currentGitBranch(projectDir string) (string, error) {
+	out, err := r.executeCommand(localCommand, projectDir, "git", "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), err
+}
+
+// gitHeadRef returns the current branch, or the commit HEAD is at if it's detached
+func (r *runner) gitHeadRef(projectDir string) (string, error) {
+	branch, err := r.currentGitBranch(projectDir)
+	if err != nil || branch != "HEAD" {
+		return branch, err
+	}
+	out, err := r.executeCommand(localCommand, projectDir, "git", "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// gitSwitchBack checks out the branch or commit the project was on before it was updated. It runs as cleanup, so
+// it's done even when the run is interrupted.
+func (r *runner) gitSwitchBack(projectDir, ref string) error {
+	_, err := r.executeCommand(cleanupCommand, projectDir, "git", "checkout", ref)
+	return err
+}
+
+func (r *runner) gitCheckout(projectDir, branch string) error {
+	_, err := r.executeCommand(localCommand, projectDir, "git", "checkout", branch)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// defaultBranch returns the branch <remote>/HEAD points to, e.g. "main" for refs/remotes/origin/main.
+// If <remote>/HEAD isn't set, it falls back to a local "main" or "master" branch, in that order.
+func (r *runner) defaultBranch(projectDir, remote string) (string, error) {
+	out, err := r.executeCommand(localCommand, projectDir, "git", "symbolic-ref", "refs/remotes/"+remote+"/HEAD")
+	if err == nil {
+		return strings.TrimPrefix(strings.TrimSpace(out), "refs/remotes/"+remote+"/"), nil
+	}
+
+	for _, branch := range []string{"main", "master"} {
+		if _, err := r.executeCommand(localCommand, projectDir, "git", "rev-parse", "--verify", "--quiet", "refs/heads/"+branch); err == nil {
+			return branch, nil
+		}
+	}
+
+	return "", fmt.Errorf("%s/HEAD is not set and no local main or master branch exists: %s", remote, strings.TrimSpace(out))
+}
+
+// gitBranchExists reports whether the branch exists locally or on remote (in which case git checkout creates it).
+func (r *runner) gitBranchExists(projectDir, remote, branch string) bool {
+	return r.gitRefExists(projectDir, "refs/heads/"+branch) || r.gitRefExists(projectDir, "refs/remotes/"+remote+"/"+branch)
+}
+
+// gitRefExists reports whether the full ref, like refs/heads/main, exists
+func (r *runner) gitRefExists(projectDir, ref string) bool {
+	_, err := r.executeCommand(localCommand, projectDir, "git", "rev-parse", "--verify", "--quiet", ref)
+	return err == nil
+}
+
+// ErrAborted is returned when the user chooses to quit at a confirmation prompt
+var ErrAborted = errors.New("aborted by user")
+
+type answer int
+
+const (
+	answerNo answer = iota
+	answerYes
+	answerAll
+	answerQuit
+)
+
+// The answers a confirmation prompt accepts
+var (
+	yesOrNo    = []answer{answerYes, answerNo}
+	allAnswers = []answer{answerYes, answerNo, answerAll, answerQuit}
+)
+
+// answerWords are the words of each answer, the first letter of which is accepted too
+var answerWords = map[answer]string{
+	answerYes:  "yes",
+	answerNo:   "no",
+	answerAll:  "all",
+	answerQuit: "quit",
+}
+
+// stdinLines are the lines of stdin, read by one goroutine shared by all prompts and started by the first one. A
+// prompt that stops waiting, e.g. when the run is cancelled, leaves the line it waited for to the next one, instead
+// of a goroutine of its own swallowing it. It's closed when there's no more input, with stdinErr telling why.
+var (
+	stdinLines   = make(chan string)
+	stdinErr     error
+	stdinStarted sync.Once
+)
+
+// readStdin sends the lines of stdin to stdinLines until there are no more. The last line doesn't need to end with a
+// newline.
+func readStdin() {
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		text, err := reader.ReadString('\n')
+		if text != "" {
+			stdinLines <- strings.TrimSuffix(strings.TrimSuffix(text, "\n"), "\r")
+		}
+		if err != nil {
+			stdinErr = err
+			close(stdinLines)
+			return
+		}
+	}
+}
+
+// confirm asks the user a question that can be answered with one of the choices, and asks again until it is.
+// Just pressing enter gives the default answer, shown in upper case. When there's no more input, e.g. stdin is
+// closed, it's a quit, or a no if quitting isn't one of the choices.
+func (r *runner) confirm(choices []answer, defaultAnswer answer, question string, args ...any) answer {
+	var options []string
+	for _, choice := range choices {
+		word := answerWords[choice]
+		if choice == defaultAnswer {
+			word = strings.ToUpper(word[:1]) + word[1:]
+		}
+		if choice == answerAll {
+			word += " remaining"
+		}
+		options = append(options, "["+word[:1]+"]"+word[1:])
+	}
+	prompt := fmt.Sprintf(question, args...) + " " + strings.Join(options, ", ")
+
+	for {
+		input, err := r.readInput(prompt)
+		if err != nil {
+			switch {
+			case err == io.EOF:
+				r.logger.Warnf("No more input to answer with")
+			case r.ctx.Err() == nil:
+				r.logger.Errorf("Error reading the answer: %v", err)
+			}
+			for _, choice := range choices {
+				if choice == answerQuit {
+					return answerQuit
+				}
+			}
+			return answerNo
+		}
+
+		input = strings.ToLower(strings.TrimSpace(input))
+		if input == "" {
+			return defaultAnswer
+		}
+		for _, choice := range choices {
+			if word := answerWords[choice]; input == word || input == word[:1] {
+				return choice
+			}
+		}
+		fmt.Printf("Please answer with one of %s\n", strings.Join(options, ", "))
+	}
+}
+
+// readInput shows the prompt and returns the line the user wrote. The last line of input doesn't need to end with
+// a newline, io.EOF is only returned when there's nothing left. It stops waiting when the run is cancelled.
+func (r *runner) readInput(prompt string) (string, error) {
+	fmt.Println(r.colorize(chalk.Yellow, ">>> "+prompt))
+	stdinStarted.Do(func() { go readStdin() })
+
+	select {
+	case <-r.ctx.Done():
+		return "", r.ctx.Err()
+	case text, ok := <-stdinLines:
+		if !ok {
+			return "", stdinErr
+		}
+		return text, nil
+	}
+}
+
+func directoryHasFile(directoryPath, fileName string) bool {
+	filePath := path.Join(directoryPath, fileName)
+
+	// Use os.Stat to get the file info
+	_, err := os.Stat(filePath)
+
+	// If the error is nil, the file exists
+	if os.IsNotExist(err) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,253 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/charmbracelet/log"
+	"golang.org/x/mod/module"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPendingUpdates(t *testing.T) {
+	const dep = "github.com/foo/bar"
+	const pseudo = "v0.0.0-20240102150405-abcdef123456"
+
+	tests := []struct {
+		name           string
+		current        string
+		target         string
+		allowDowngrade bool
+		force          bool
+		constraint     string
+		want           []PendingUpdate
+	}{
+		{name: "newer target", current: "v1.1.0", target: "v1.2.0", want: []PendingUpdate{{Module: dep, CurrentVersion: "v1.1.0", TargetVersion: "v1.2.0"}}},
+		{name: "equal", current: "v1.2.0", target: "v1.2.0"},
+		{name: "equal with force", current: "v1.2.0", target: "v1.2.0", force: true, want: []PendingUpdate{{Module: dep, CurrentVersion: "v1.2.0", TargetVersion: "v1.2.0"}}},
+		{name: "older target", current: "v1.2.0", target: "v1.1.0"},
+		{name: "older target with allow downgrade", current: "v1.2.0", target: "v1.1.0", allowDowngrade: true, want: []PendingUpdate{{Module: dep, CurrentVersion: "v1.2.0", TargetVersion: "v1.1.0"}}},
+		{name: "pseudo-version to release", current: pseudo, target: "v1.0.0", want: []PendingUpdate{{Module: dep, CurrentVersion: pseudo, TargetVersion: "v1.0.0"}}},
+		{name: "release to older pseudo-version", current: "v1.0.0", target: pseudo},
+		{name: "pseudo-version to the same commit", current: pseudo, target: "v1.2.4-0.20240102150405-abcdef123456"},
+		{name: "pseudo-version to its commit hash", current: pseudo, target: "abcdef1"},
+		{name: "not allowed by constraint", current: "v1.1.0", target: "v1.2.0", constraint: ">=v1.1.1"},
+		{name: "allowed by constraint", current: "v1.1.0", target: "v1.2.0", constraint: "<v2.0.0", want: []PendingUpdate{{Module: dep, CurrentVersion: "v1.1.0", TargetVersion: "v1.2.0"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var constraint VersionConstraint
+			if tt.constraint != "" {
+				var err error
+				if constraint, err = ParseVersionConstraint(tt.constraint); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			requires := []module.Version{{Path: "github.com/other/mod", Version: "v0.1.0"}, {Path: dep, Version: tt.current}}
+			got := defaultRunner().pendingUpdates("go.mod", requires, []DependencyUpdate{{Module: dep, Version: tt.target}}, tt.allowDowngrade, tt.force, constraint)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pendingUpdates() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShouldUpgradeVersion(t *testing.T) {
+	constraint, err := ParseVersionConstraint("<v2.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		current, requested string
+		opts               Options
+		want               bool
+	}{
+		{current: "v1.1.0", requested: "v1.2.0", want: true},
+		{current: "v1.2.0", requested: "v1.2.0", want: false},
+		{current: "v1.2.0", requested: "v1.2.0", opts: Options{Force: true}, want: true},
+		{current: "v1.2.0", requested: "v1.1.0", want: false},
+		{current: "v1.2.0", requested: "v1.1.0", opts: Options{AllowDowngrade: true}, want: true},
+		{current: "v2.1.0", requested: "v2.2.0", opts: Options{OnlyIfCurrent: constraint}, want: false},
+		{current: "v1.2.0", requested: "main", want: true},
+	}
+
+	for _, tt := range tests {
+		if got := ShouldUpgradeVersion(tt.current, tt.requested, &tt.opts); got != tt.want {
+			t.Errorf("ShouldUpgradeVersion(%q, %q, %+v) = %v, want %v", tt.current, tt.requested, tt.opts, got, tt.want)
+		}
+	}
+}
+
+func TestPendingUpdatesNotFound(t *testing.T) {
+	requires := []module.Version{{Path: "github.com/other/mod", Version: "v0.1.0"}}
+	if got := defaultRunner().pendingUpdates("go.mod", requires, []DependencyUpdate{{Module: "github.com/foo/bar", Version: "v1.2.0"}}, false, false, nil); got != nil {
+		t.Errorf("pendingUpdates() = %v, want no updates for a module that isn't required", got)
+	}
+	if got := defaultRunner().pendingUpdates("go.mod", nil, []DependencyUpdate{{Module: "github.com/foo/bar", Version: "v1.2.0"}}, false, true, nil); got != nil {
+		t.Errorf("pendingUpdates() = %v, want no updates without any requirements", got)
+	}
+}
+
+func TestSplitTrailers(t *testing.T) {
+	tests := []struct {
+		name         string
+		message      string
+		wantBody     string
+		wantTrailers []string
+	}{
+		{name: "no trailers", message: "Update foo\n\nSome details: here and there\nmore details", wantBody: "Update foo\n\nSome details: here and there\nmore details"},
+		{name: "subject only", message: "Fix: the build\n", wantBody: "Fix: the build"},
+		{
+			name:         "marker and sign-off",
+			message:      "Update foo\n\nUpdated-by: go-dep-updater\nSigned-off-by: Jane <jane@example.com>\n",
+			wantBody:     "Update foo",
+			wantTrailers: []string{commitTrailer, "Signed-off-by: Jane <jane@example.com>"},
+		},
+		{
+			name:         "amended before",
+			message:      "Update foo\n\nUpdate bar\n\nUpdated-by: go-dep-updater",
+			wantBody:     "Update foo\n\nUpdate bar",
+			wantTrailers: []string{commitTrailer},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, trailers := splitTrailers(tt.message)
+			if body != tt.wantBody || !reflect.DeepEqual(trailers, tt.wantTrailers) {
+				t.Errorf("splitTrailers() = %q, %q, want %q, %q", body, trailers, tt.wantBody, tt.wantTrailers)
+			}
+		})
+	}
+}
+
+func TestIsDepUpdateCommit(t *testing.T) {
+	if !isDepUpdateCommit("Update foo\n\nUpdated-by: go-dep-updater\nSigned-off-by: Jane <jane@example.com>") {
+		t.Error("a commit with the marker among its trailers isn't recognized")
+	}
+	if isDepUpdateCommit("Revert the update\n\nUpdated-by: go-dep-updater\n\nThe tests fail with it.") {
+		t.Error("a commit quoting the marker outside of its trailers is recognized")
+	}
+}
+
+func TestChangedFiles(t *testing.T) {
+	before := map[string]string{
+		"app/go.mod":     " M aaa",
+		"app/.env.local": "?? bbb",
+		"app/gen.go":     " M ccc",
+		"app/old.go":     " M ddd",
+	}
+	after := map[string]string{
+		"app/go.mod":     " M aaa",
+		"app/.env.local": "?? changed",
+		"app/gen.go":     " M changed",
+		"app/new.go":     "?? eee",
+	}
+
+	want := []string{"app/gen.go", "app/new.go", "app/old.go"}
+	if got := changedFiles(before, after); !reflect.DeepEqual(got, want) {
+		t.Errorf("changedFiles() = %q, want %q", got, want)
+	}
+}
+
+func TestClassifyFailure(t *testing.T) {
+	exitErr := errors.New("exit status 1")
+	tests := []struct {
+		name string
+		err  *CommandError
+		want string
+	}{
+		{
+			name: "network error of go get",
+			err:  &CommandError{Cmd: "go get foo@v1.2.3", Output: "dial tcp: Connection refused", Err: exitErr, goSubcommand: "get"},
+			want: FailureNetwork,
+		},
+		{
+			name: "network error of git",
+			err:  &CommandError{Cmd: "git push origin main", Output: "fatal: Could not resolve host: example.com", Err: exitErr},
+			want: FailureNetwork,
+		},
+		{
+			name: "failed test printing a network error",
+			err:  &CommandError{Cmd: "go test ./...", Output: "--- FAIL: TestClient\n    client_test.go:12: Connection refused\nFAIL\tapp\t0.1s", Err: exitErr, goSubcommand: "test"},
+			want: FailureTest,
+		},
+		{
+			name: "build error mentioning a network error",
+			err:  &CommandError{Cmd: "go build ./...", Output: "./main.go:3:2: Connection refused redeclared in this block", Err: exitErr, goSubcommand: "build"},
+			want: FailureCompile,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyFailure(StatusFailedTests, tt.err); got != tt.want {
+				t.Errorf("classifyFailure() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryTransientCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := newRunner(ctx, log.New(io.Discard))
+	r.networkRetries = 3
+	r.networkRetryDelay = time.Hour
+
+	attempts := 0
+	time.AfterFunc(10*time.Millisecond, cancel)
+	err := r.retryTransient("git fetch", func() error {
+		attempts++
+		return errors.New("fatal: Could not resolve host: example.com")
+	})
+	if !errors.Is(err, errInterrupted) || attempts != 1 {
+		t.Errorf("retryTransient() = %v after %d attempts, want %v after 1", err, attempts, errInterrupted)
+	}
+}
+
+func TestRunConcurrently(t *testing.T) {
+	dir := t.TempDir()
+	goMod := "module example.com/app\n\ngo 1.22\n\nrequire github.com/foo/bar v1.2.0\n"
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(goMod), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := DefaultOptions()
+	opts.RootDirs = []string{dir}
+	opts.Dependencies = []DependencyUpdate{{Module: "github.com/foo/bar", Version: "v1.3.0"}}
+	opts.Check = true
+	opts.Quiet = true
+
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results, err := Run(context.Background(), opts)
+			if err == nil && (len(results) != 1 || results[0].Status != StatusOutdated) {
+				err = fmt.Errorf("got results %v, want the project outdated", results)
+			}
+			errs[i] = err
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if opts.Dependencies[0].Version != "v1.3.0" || len(opts.RootDirs) != 1 {
+		t.Errorf("Run changed the options: %+v", opts)
+	}
+}
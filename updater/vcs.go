@@ -0,0 +1,43 @@
+package updater
+
+import "path/filepath"
+
+// vcs is a version control system, recognized by the metadata directory at the root of its checkouts
+type vcs struct {
+	Name    string
+	MetaDir string
+}
+
+var gitVCS = vcs{Name: "git", MetaDir: ".git"}
+
+// knownVCS are the version control systems projects are detected in. Only git is supported for updating,
+// the others are recognized so their projects can be skipped with a clear message.
+var knownVCS = []vcs{
+	gitVCS,
+	{Name: "Mercurial", MetaDir: ".hg"},
+	{Name: "Subversion", MetaDir: ".svn"},
+	{Name: "Bazaar", MetaDir: ".bzr"},
+	{Name: "Fossil", MetaDir: ".fslckout"},
+}
+
+// detectVCS returns the version control system of the closest checkout at or above projectDir
+func detectVCS(projectDir string) (vcs, bool) {
+	dir, err := filepath.Abs(projectDir)
+	if err != nil {
+		return vcs{}, false
+	}
+
+	for {
+		for _, known := range knownVCS {
+			if directoryHasFile(dir, known.MetaDir) {
+				return known, true
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return vcs{}, false
+		}
+		dir = parent
+	}
+}